@@ -1,39 +1,175 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"math"
+	"os"
+	"strings"
 
+	"github.com/matm/bmp/pkg/config"
 	"github.com/matm/bmp/pkg/types"
+	"golang.org/x/term"
 )
 
-func makeStatusBar(width int, elapsed, duration float64, marks []types.Bookmark) string {
-	if width == 0 {
+// Kinds of status bar cells.
+type cellKind int
+
+const (
+	cellPlayed cellKind = iota
+	cellLeft
+	// Within a bookmarked range.
+	cellRange
+	// Within a range still being marked, up to the playhead.
+	cellOpen
+	cellHead
+)
+
+// ANSI colours of the status bar cells, by kind.
+var cellColors = map[cellKind]string{
+	cellPlayed: "\x1b[32m",
+	cellLeft:   "\x1b[2m",
+	cellRange:  "\x1b[1;33m",
+	cellOpen:   "\x1b[1;35m",
+	cellHead:   "\x1b[1m",
+}
+
+// statusBar renders the progress of a song along with its bookmarked ranges,
+// e.g.
+//
+//	01:02 =====[==>-]--- 04:00
+//
+// Played time is drawn with '=', time left with '-'. Ranges are enclosed
+// in brackets, a range still being marked is filled with '~' up to the
+// playhead '>'.
+type statusBar struct {
+	// Total width in characters, labels included.
+	width int
+	// Use ANSI colours.
+	colors bool
+	// Show the elapsed and total time around the bar.
+	labels bool
+}
+
+// render returns the status bar of a song. Empty if it doesn't fit the width
+// or the song has no duration.
+func (sb statusBar) render(elapsed, duration float64, marks []types.Bookmark) string {
+	width := sb.width
+	var left, right string
+	if sb.labels {
+		left = secondsToHuman(int(elapsed)) + " "
+		right = " " + secondsToHuman(int(duration))
+		width -= len(left) + len(right)
+	}
+	if width <= 0 || duration <= 0 {
 		return ""
 	}
-	b := make([]rune, width)
-	for k := 0; k < width; k++ {
-		b[k] = '-'
+	elapsed = math.Max(0, math.Min(elapsed, duration))
+	// Cell of a time, clamped to the bar.
+	cell := func(secs float64) int {
+		k := int(math.Floor(secs * float64(width) / duration))
+		if k < 0 {
+			return 0
+		}
+		if k >= width {
+			return width - 1
+		}
+		return k
 	}
-	pos := math.Floor(elapsed * float64(width) / duration)
-	for k := 0; k < int(pos); k++ {
-		b[k] = '='
+
+	glyphs := make([]rune, width)
+	kinds := make([]cellKind, width)
+	played := cell(elapsed)
+	if elapsed >= duration {
+		played = width
 	}
-	if pos > 1 {
-		pos--
+	for k := range glyphs {
+		glyphs[k], kinds[k] = '-', cellLeft
+		if k < played {
+			glyphs[k], kinds[k] = '=', cellPlayed
+		}
+	}
+	head := 0
+	if played > 0 {
+		head = played - 1
 	}
-	b[int(pos)] = '>'
-	mu.Lock()
 	for _, bm := range marks {
-		start, err := humanToSeconds(bm.Start)
+		start, err := config.ParseTime(bm.Start)
+		if err != nil {
+			continue
+		}
+		first := cell(start)
+		if bm.End == "" {
+			// Being marked.
+			for k := first + 1; k < head; k++ {
+				glyphs[k], kinds[k] = '~', cellOpen
+			}
+			glyphs[first], kinds[first] = '[', cellOpen
+			continue
+		}
+		end, err := config.ParseTime(bm.End)
 		if err != nil {
-			mu.Unlock()
-			log.Print(err)
 			continue
 		}
-		pos := int(math.Floor(float64(start) * float64(width) / duration))
-		b[pos] = '*'
+		last := int(math.Ceil(end*float64(width)/duration)) - 1
+		if last >= width {
+			last = width - 1
+		}
+		if last < first {
+			last = first
+		}
+		for k := first; k <= last; k++ {
+			kinds[k] = cellRange
+		}
+		glyphs[first], glyphs[last] = '[', ']'
+		if first == last {
+			glyphs[first] = '|'
+		}
+	}
+	glyphs[head], kinds[head] = '>', cellHead
+
+	var b strings.Builder
+	b.WriteString(left)
+	for k, g := range glyphs {
+		if sb.colors && (k == 0 || kinds[k] != kinds[k-1]) {
+			b.WriteString(ansiReset + cellColors[kinds[k]])
+		}
+		b.WriteRune(g)
+	}
+	if sb.colors {
+		b.WriteString(ansiReset)
 	}
-	mu.Unlock()
-	return string(b)
+	b.WriteString(right)
+	return b.String()
+}
+
+// makeStatusBar returns a plain status bar of the given width, without labels.
+func makeStatusBar(width int, elapsed, duration float64, marks []types.Bookmark) string {
+	return statusBar{width: width}.render(elapsed, duration, marks)
+}
+
+// terminalBar returns a status bar fitting the width of terminal f, with
+// colours if supported. Falls back to a bar of statusBarLength characters
+// without colours if f is not a terminal.
+func terminalBar(f *os.File) statusBar {
+	fd := int(f.Fd())
+	width, _, err := term.GetSize(fd)
+	if err != nil || !term.IsTerminal(fd) {
+		// Room for the labels.
+		return statusBar{width: statusBarLength + 12, labels: true}
+	}
+	return statusBar{width: width - 1, labels: true, colors: colorTerm()}
+}
+
+// colorTerm returns true if the terminal supports ANSI colours. See
+// https://no-color.org for NO_COLOR.
+func colorTerm() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return os.Getenv("TERM") != "dumb"
+}
+
+// printStatusBar prints the status bar of a song to the standard output.
+func printStatusBar(elapsed, duration float64, marks []types.Bookmark) {
+	fmt.Println(terminalBar(os.Stdout).render(elapsed, duration, marks))
 }
@@ -22,8 +22,15 @@ func Test_makeStatusBar(t *testing.T) {
 		{"beginning", args{10, 0.0, 30.0, nil}, ">---------"},
 		{"half", args{10, 15.0, 30.0, nil}, "====>-----"},
 		{"full", args{10, 30.0, 30.0, nil}, "=========>"},
-		{"current pos before bookmark", args{10, 10.0, 30.0, []types.Bookmark{{Start: "00:15", End: "00:20"}}}, "==>--*----"},
-		{"current pos after bookmark", args{10, 25.0, 30.0, []types.Bookmark{{Start: "00:15", End: "00:30"}}}, "=====*=>--"},
+		{"current pos before bookmark", args{10, 10.0, 30.0, []types.Bookmark{{Start: "00:15", End: "00:20"}}}, "==>--[]---"},
+		{"current pos after bookmark", args{10, 25.0, 30.0, []types.Bookmark{{Start: "00:15", End: "00:30"}}}, "=====[=>-]"},
+		{"current pos in bookmark", args{10, 18.0, 30.0, []types.Bookmark{{Start: "00:09", End: "00:24"}}}, "===[=>-]--"},
+		{"single cell bookmark", args{10, 0.0, 30.0, []types.Bookmark{{Start: "00:12", End: "00:13"}}}, ">---|-----"},
+		{"bookmark being marked", args{10, 21.0, 30.0, []types.Bookmark{{Start: "00:06"}}}, "==[~~~>---"},
+		{"bookmark at the end", args{10, 3.0, 30.0, []types.Bookmark{{Start: "00:30", End: "00:30"}}}, ">--------|"},
+		{"past the end", args{10, 31.0, 30.0, nil}, "=========>"},
+		{"no duration", args{10, 3.0, 0, nil}, ""},
+		{"bad bookmark", args{10, 0.0, 30.0, []types.Bookmark{{Start: "0:1", End: "00:20"}}}, ">---------"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -33,3 +40,24 @@ func Test_makeStatusBar(t *testing.T) {
 		})
 	}
 }
+
+func Test_statusBar(t *testing.T) {
+	marks := []types.Bookmark{{Start: "00:15", End: "00:20"}}
+	tests := []struct {
+		name string
+		bar  statusBar
+		want string
+	}{
+		{"labels", statusBar{width: 22, labels: true}, "00:10 ==>--[]--- 00:30"},
+		{"labels only", statusBar{width: 12, labels: true}, ""},
+		{"colors", statusBar{width: 10, colors: true},
+			"\x1b[0m\x1b[32m==\x1b[0m\x1b[1m>\x1b[0m\x1b[2m--\x1b[0m\x1b[1;33m[]\x1b[0m\x1b[2m---\x1b[0m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.bar.render(10.0, 30.0, marks); got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// printChanges shows the changes reported by a normalization pass. Returns
+// true if anything changed.
+func printChanges(changes []string) bool {
+	for _, ch := range changes {
+		fmt.Println(ch)
+	}
+	return len(changes) > 0
+}
+
+// markTime returns the current song and the time to mark: the current
+// position, or the time given, relative to the current position if signed.
+func (s *session) markTime(arg string) (*types.Song, float64, error) {
+	te := timeExpr{relative: true}
+	if arg != "" {
+		var err error
+		te, err = parseTimeExpr(arg)
+		if err != nil {
+			return nil, 0, userError(err.Error())
+		}
+	}
+	st, err := s.pmp.Status()
+	if err != nil {
+		return nil, 0, err
+	}
+	if te.relative && st.State != "play" {
+		return nil, 0, errNotPlaying
+	}
+	song, err := s.pmp.CurrentSong()
+	if err != nil {
+		return nil, 0, err
+	}
+	pos := te.at(st.Elapsed)
+	if pos > song.Duration {
+		return nil, 0, errPastEnd
+	}
+	return song, pos, nil
+}
+
+func (s *session) markStart(args []string) error {
+	if s.bOpen {
+		return userError("Missing closing bookmark, please use ']' first")
+	}
+	song, pos, err := s.markTime(args[0])
+	if err != nil {
+		return err
+	}
+	s.bOpen = true
+	start := config.FormatTime(pos)
+	s.mu.Lock()
+	if _, ok := s.bms[song.File]; !ok {
+		s.bms[song.File] = make([]types.Bookmark, 0)
+		s.order = append(s.order, song.File)
+	}
+	s.bms[song.File] = append(s.bms[song.File], types.Bookmark{Start: start, Tags: song.Tags()})
+	s.mu.Unlock()
+	fmt.Println(start)
+	return nil
+}
+
+func (s *session) markEnd(args []string) error {
+	if !s.bOpen {
+		return userError("Missing opening bookmark, please use '[' first")
+	}
+	song, pos, err := s.markTime(args[0])
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	n := len(s.bms[song.File])
+	if n == 0 || s.bms[song.File][n-1].End != "" {
+		s.mu.Unlock()
+		return userError("the opening bookmark is on another song")
+	}
+	s.bOpen = false
+	bm := &s.bms[song.File][n-1]
+	bm.End = config.FormatTime(pos)
+	fmt.Printf("%s-%s\n", bm.Start, bm.End)
+	var changes []string
+	s.bms[song.File], changes = config.NormalizeBookmarks(s.bms[song.File])
+	s.mu.Unlock()
+	printChanges(changes)
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+func (s *session) deleteBookmark(args []string) error {
+	song, idx, err := s.bookmarkAt(args[0])
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.bms[song.File] = append(s.bms[song.File][:idx], s.bms[song.File][idx+1:]...)
+	s.mu.Unlock()
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+func (s *session) deleteAllBookmarks(args []string) error {
+	song, err := s.editedSong()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bms[song.File]; !ok {
+		return errNoBookmark
+	}
+	delete(s.bms, song.File)
+	s.checkSelected()
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+// splitRange splits the boundaries given to the c command, either separated
+// with a space or with a dash, e.g. "01:00 -2" or "01:00-01:30". end is empty
+// if only the start is given.
+func splitRange(s string) (start, end string, err error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		return fields[0], fields[1], nil
+	default:
+		return "", "", userError(fmt.Sprintf("bad time range %q", s))
+	}
+	// A dash following a digit separates the boundaries, others are signs.
+	for k := 1; k < len(s); k++ {
+		if s[k] == '-' && s[k-1] >= '0' && s[k-1] <= '9' {
+			return s[:k], s[k+1:], nil
+		}
+	}
+	return s, "", nil
+}
+
+// changeBookmark sets new boundaries of a range. Signed times move a
+// boundary, e.g. "c 3 +0.5" starts range 3 half a second later.
+func (s *session) changeBookmark(args []string) error {
+	song, idx, err := s.bookmarkAt(args[0])
+	if err != nil {
+		return err
+	}
+	startExpr, endExpr, err := splitRange(args[1])
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	bm := s.bms[song.File][idx]
+	s.mu.Unlock()
+	if bm.End == "" {
+		return errOpenRange
+	}
+	start, err := config.ParseTime(bm.Start)
+	if err != nil {
+		return err
+	}
+	end, err := config.ParseTime(bm.End)
+	if err != nil {
+		return err
+	}
+	te, err := parseTimeExpr(startExpr)
+	if err != nil {
+		return userError(fmt.Sprintf("wrong start time: %v", err))
+	}
+	start = te.at(start)
+	if endExpr != "" {
+		te, err := parseTimeExpr(endExpr)
+		if err != nil {
+			return userError(fmt.Sprintf("wrong end time: %v", err))
+		}
+		end = te.at(end)
+	}
+	if end < start {
+		return userError("end time must be after start")
+	}
+	if song.Duration > 0 && start > song.Duration {
+		return userError("start can't be greater than the song's length")
+	}
+	// Save new value.
+	s.mu.Lock()
+	s.bms[song.File][idx].Start, s.bms[song.File][idx].End = config.FormatTime(start), config.FormatTime(end)
+	var changes []string
+	s.bms[song.File], changes = config.NormalizeBookmarks(s.bms[song.File])
+	s.mu.Unlock()
+	printChanges(changes)
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+// listBookmarks lists all bookmarks for the edited song.
+func (s *session) listBookmarks(args []string) error {
+	song, err := s.editedSong()
+	if err != nil {
+		return err
+	}
+	for _, bm := range s.bookmarks(song.File) {
+		fmt.Printf("%s-%s\n", bm.Start, bm.End)
+	}
+	return nil
+}
+
+// listNumberedBookmarks lists all bookmarks for the edited song, prefixed
+// with a number.
+func (s *session) listNumberedBookmarks(args []string) error {
+	song, err := s.editedSong()
+	if err != nil {
+		return err
+	}
+	for k, bm := range s.bookmarks(song.File) {
+		fmt.Printf("%d\t%s-%s\n", k+1, bm.Start, bm.End)
+	}
+	return nil
+}
+
+// write writes the bookmarks buffer to a file, or to stdout if no filename
+// given.
+func (s *session) write(args []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.bms) == 0 {
+		return userError("no bookmarks")
+	}
+	filename := args[0]
+	if filename == "" {
+		_, err := config.WriteBookmarkFile(os.Stdout, s.bms, s.order)
+		return err
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return eris.Wrap(err, "save bookmark file")
+	}
+	defer f.Close()
+	n, err := config.WriteBookmarkFile(f, s.bms, s.order)
+	if err != nil {
+		return err
+	}
+	fmt.Println(n)
+	s.modified = false
+	return nil
+}
+
+func (s *session) rate(args []string) error {
+	song, idx, err := s.bookmarkAt(args[0])
+	if err != nil {
+		return err
+	}
+	rating := int(args[1][0] - '0')
+	s.mu.Lock()
+	s.bms[song.File][idx].Rating = rating
+	s.mu.Unlock()
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+func (s *session) normalize(args []string) error {
+	s.mu.Lock()
+	changes := config.NormalizeBookmarkSet(s.bms)
+	s.mu.Unlock()
+	if !printChanges(changes) {
+		return userError("bookmarks already normalized")
+	}
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+// selectSong selects the song whose bookmarks are edited, by position in the
+// last listing or by path. "-" goes back to editing the current song.
+func (s *session) selectSong(args []string) error {
+	switch arg := args[0]; {
+	case arg == "":
+		if s.selected == "" {
+			fmt.Println("editing the current song")
+			return nil
+		}
+	case arg == "-":
+		s.selected = ""
+		fmt.Println("editing the current song")
+		return nil
+	default:
+		song := arg
+		if idx, err := strconv.Atoi(arg); err == nil {
+			if idx < 1 || idx > len(s.results) {
+				return errNoSuchSong
+			}
+			song = s.results[idx-1]
+		}
+		s.mu.Lock()
+		_, ok := s.bms[song]
+		s.mu.Unlock()
+		if !ok {
+			return userError(fmt.Sprintf("no bookmarks for %q", song))
+		}
+		s.selected = song
+	}
+	fmt.Printf("editing %s\n", s.selected)
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a shell command.
+type command struct {
+	// Key typed to run the command.
+	key string
+	// Other keys running the command, e.g. the ed-like ,p for p.
+	alt []string
+	// Grammar of the arguments following the key: a regexp whose submatches
+	// are the arguments of the handler.
+	args string
+	// Arguments as shown by the help, e.g. "pos [times]".
+	usage string
+	help  string
+	// Handler of the command.
+	run func(s *session, args []string) error
+	// Works without MPD, in offline mode.
+	offline bool
+	re      *regexp.Regexp
+}
+
+// A userError is reported to the user as is, e.g. a missing argument or a
+// command not applicable in the current state.
+type userError string
+
+func (e userError) Error() string {
+	return string(e)
+}
+
+// Errors common to several commands.
+const (
+	errNotPlaying  = userError("Please starting playing a song first")
+	errNoBookmark  = userError("no bookmark for this song")
+	errOutOfRange  = userError("out of range")
+	errMissingPos  = userError("missing line number (use 'n' command)")
+	errOpenRange   = userError("range still being marked, please use ']' first")
+	errPastEnd     = userError("time past the end of the song")
+	errNoSuchSong  = userError("no such song, list songs with ls, search, marked or all first")
+	errUnsavedOpen = userError("Warning: bookmarks list modified, save it first with 'W'")
+	errOffline     = userError("MPD is unreachable, command not available in offline mode")
+)
+
+// commands are all the shell commands, in the order of the help.
+var commands = []*command{
+	{key: "q", help: "Exit the program", run: (*session).quit, offline: true},
+	{key: "Q", help: "Force exit the program, even with unsaved changes", run: (*session).forceQuit, offline: true},
+	{key: "i", help: "Show current song information", run: (*session).songInfo},
+	{key: "f", args: `(?: (\S+))?`, usage: "[time]", help: "Forward seek in current song by time, e.g. 30 or 1:00, 10s by default, see the seek setting of profiles", run: (*session).forward},
+	{key: "b", args: `(?: (\S+))?`, usage: "[time]", help: "Backward seek in current song by time, e.g. 30 or 1:00, 10s by default, see the seek setting of profiles", run: (*session).backward},
+	{key: "g", args: ` (\S+)`, usage: "time", help: "Go to time in current song, e.g. 02:15, or +5 and -5 to move from the current position", run: (*session).goTo},
+	{key: "[", args: `(?: (\S+))?`, usage: "[time]", help: "Bookmark start: mark the beginning of the time frame, at the current position or at time, e.g. 01:02.5, or -2 for two seconds ago", run: (*session).markStart},
+	{key: "]", args: `(?: (\S+))?`, usage: "[time]", help: "Bookmark end: mark the end of the time frame, at the current position or at time. The time interval is added to the list of bookmarks for the current song", run: (*session).markEnd},
+	{key: "d", args: ` ?(\d*)`, usage: "pos", help: "Delete bookmark entry at position pos", run: (*session).deleteBookmark, offline: true},
+	{key: "D", help: "Delete all bookmark entries for the edited song, the current one unless selected with sel", run: (*session).deleteAllBookmarks, offline: true},
+	{key: "c", args: ` ?(\d{1,2}) (.+)`, usage: "pos start[-end]", help: "Change bookmark entry at position pos and set new start and end time boundaries, e.g. 01:00-01:30 or 01:00 01:30. Signed times move a boundary, e.g. +0.5 moves the start half a second later and +0 -2 the end two seconds earlier", run: (*session).changeBookmark, offline: true},
+	{key: "{", args: ` ?(\d{1,2})(?: ([+-]?\d+))?`, usage: "pos [steps]", help: "Nudge the start of bookmark entry at position pos by a number of steps, 1 by default, e.g. -2 for two steps earlier, then play from a few seconds before it. See the nudge and nudge_preroll settings of profiles", run: (*session).nudgeStart, offline: true},
+	{key: "}", args: ` ?(\d{1,2})(?: ([+-]?\d+))?`, usage: "pos [steps]", help: "Nudge the end of bookmark entry at position pos by a number of steps, then play from a few seconds before it", run: (*session).nudgeEnd, offline: true},
+	{key: "edit", args: ` (\d{1,2})`, usage: "pos", help: "Edit bookmark entry at position pos with single keys: " + editHelp, run: (*session).editRange, offline: true},
+	{key: "p", alt: []string{",p"}, help: "List of current bookmarked locations in the edited song", run: (*session).listBookmarks, offline: true},
+	{key: "n", alt: []string{",n"}, help: "Numbered list of current bookmarked locations in the edited song", run: (*session).listNumberedBookmarks, offline: true},
+	{key: "sel", args: ` ?(.*)`, usage: "[song|-]", help: "Show or select the song edited by d, D, c, p, n, rate and nudging, by position in the last listing or by path, even with MPD stopped. '-' goes back to the current song", run: (*session).selectSong, offline: true},
+	{key: "w", args: ` ?(.*)`, usage: "[file]", help: "List bookmarks on standard output. Writes to file if argument provided", run: (*session).write, offline: true},
+	{key: "rate", args: ` (\d{1,2}) ([0-5])`, usage: "pos rating", help: "Rate bookmark entry at position pos from 1 to 5, 0 to unrate. Used by the weighted play mode", run: (*session).rate, offline: true},
+	{key: "W", help: "Save bookmarks to the collection they were loaded from", run: (*session).storeCollection, offline: true},
+	{key: "collections", args: ` ?(.*)`, usage: "[pattern]", help: "List the collections of the storage. With a pattern, list collections having matching songs (sqlite storage only)", run: (*session).collections, offline: true},
+	{key: "open", args: ` (.+)`, usage: "name", help: "Load a collection from the storage in place of the current bookmarks", run: (*session).open, offline: true},
+	{key: "history", args: ` ?(\d*)`, usage: "[id]", help: "List the saved revisions of the collection, or load revision id (sqlite storage only)", run: (*session).history, offline: true},
+	{key: "E", help: "Edit all bookmarks in $EDITOR, as a bookmarks file. Changes are applied once the file is valid", run: (*session).editAll, offline: true},
+	{key: "undo", help: "Undo the last edit made with E", run: (*session).undoEdit, offline: true},
+	{key: "N", help: "Normalize bookmarks of all songs: sort, merge overlapping ranges and drop empty ones", run: (*session).normalize, offline: true},
+	{key: "resolve", help: "Look up songs moved or renamed in the music library, using their recorded tags, and offer to rewrite their paths", run: (*session).resolveSongs},
+	{key: "ls", args: ` ?(.*)`, usage: "[path]", help: "Browse a directory of the music library, the root one by default", run: (*session).browse},
+	{key: "search", args: ` (.+)`, usage: "text", help: "Search the music library for songs having any tag containing the text", run: (*session).search},
+	{key: "list", args: ` ([a-zA-Z_]+) ?(.*)`, usage: "tag [text]", help: "List the unique values of a tag, e.g. artist or album, among songs having any tag containing the optional text", run: (*session).list},
+	{key: "all", args: ` ?(.*)`, usage: "[pattern]", help: "Numbered list of the bookmarked locations of all songs, optionally only songs whose path, artist or title contains the pattern", run: (*session).listAll, offline: true},
+	{key: "goto", args: ` (\d+)(?: (\d{1,2}))?`, usage: "song [pos]", help: "Play song at position song of the last listing, from the start of its bookmark entry at position pos if given", run: (*session).jump},
+	{key: "marked", args: ` ?(.*)`, usage: "[text]", help: "List the songs having bookmarks, optionally only those whose path contains the text", run: (*session).marked, offline: true},
+	{key: "add", args: ` ?(\d*)`, usage: "[pos]", help: "Add song at position pos of the last ls, search, marked or all listing to the MPD queue, or all of them", run: (*session).add},
+	{key: "start", args: ` (\d+)`, usage: "pos", help: "Play song at position pos of the last ls, search, marked or all listing", run: (*session).startSong},
+	{key: "vol", args: ` ?([+-]?\d*)`, usage: "[N|+N|-N]", help: "Show or set the volume from 0 to 100, or change it with a +N or -N offset", run: (*session).volume},
+	{key: "outputs", help: "List the audio outputs, of the partition given with -partition if any", run: (*session).outputs},
+	{key: "output", args: ` (\d+) ?(on|off)?`, usage: "id [on|off]", help: "Turn audio output id on or off, or toggle it, in the partition given with -partition if any", run: (*session).switchOutput},
+	{key: "ui", help: "Switch to the full-screen terminal UI, q to come back", run: (*session).fullScreen},
+	{key: "profile", args: ` ?(.*)`, usage: "[name]", help: "List the profiles of the configuration file, or switch to another MPD server with profile name", run: (*session).useProfile},
+	{key: "r", help: "Start the autoplay of the best parts", run: (*session).run},
+	{key: "loop", args: ` (\d{1,2})(?: (\d+))?`, usage: "pos [times]", help: "Practice mode: loop bookmark entry at position pos of the current song, a number of times or endlessly. Use 's' to stop", run: (*session).loop},
+	{key: "practice", args: ` ?(.*)`, usage: "[setting=value...]", help: "Show or set the practice loop settings: preroll=secs gap=secs countin=beats tempo=factor", run: (*session).practice, offline: true},
+	{key: "play", args: ` (\d{1,2})`, usage: "pos", help: "Play bookmark entry at position pos of the current song once, then pause", run: (*session).playRange},
+	{key: "preview", help: "Play all bookmark entries of the current song once, in order, then pause", run: (*session).preview},
+	{key: "fade", args: ` ?(.*)`, usage: "[secs]", help: "Show or set the default fade-in and fade-out duration in seconds of the best parts", run: (*session).fade, offline: true},
+	{key: "o", args: ` ?(.*)`, usage: "[mode]", help: "Show or set the autoplay order mode: file, shuffle, parts, weighted, repeat-one or repeat-all", run: (*session).playOrder, offline: true},
+	{key: "s", help: "Stop the autoplay of the best parts", run: (*session).stop},
+	{key: "t", help: "Toggle play/pause of current song", run: (*session).toggle},
+	{key: "h", help: "Show some help", run: (*session).help, offline: true},
+}
+
+// registry holds the shell commands, matching command lines against their
+// grammar.
+type registry struct {
+	cmds []*command
+	// Commands by key, alternate keys included.
+	byKey map[string]*command
+}
+
+// newRegistry compiles the grammar of the commands. Panics if a grammar is
+// not a valid regexp or a key is used twice.
+func newRegistry(cmds []*command) *registry {
+	r := &registry{cmds: cmds, byKey: make(map[string]*command)}
+	for _, cmd := range cmds {
+		keys := append([]string{cmd.key}, cmd.alt...)
+		for k := range keys {
+			keys[k] = regexp.QuoteMeta(keys[k])
+		}
+		cmd.re = regexp.MustCompile(fmt.Sprintf("^(?:%s)%s$", strings.Join(keys, "|"), cmd.args))
+		for _, key := range append([]string{cmd.key}, cmd.alt...) {
+			if _, ok := r.byKey[key]; ok {
+				panic(fmt.Sprintf("command key %q used twice", key))
+			}
+			r.byKey[key] = cmd
+		}
+	}
+	return r
+}
+
+// find returns the command running a line, along with its arguments. When
+// several commands match, e.g. o and open, the one with the longest key
+// wins. Returns nil if no command matches.
+func (r *registry) find(line string) (*command, []string) {
+	var found *command
+	var args []string
+	for _, cmd := range r.cmds {
+		ms := cmd.re.FindStringSubmatch(line)
+		if ms == nil || (found != nil && len(cmd.key) <= len(found.key)) {
+			continue
+		}
+		found, args = cmd, ms[1:]
+	}
+	return found, args
+}
+
+// has returns true if key runs a command.
+func (r *registry) has(key string) bool {
+	_, ok := r.byKey[key]
+	return ok
+}
+
+// lookup returns the command run by key, nil if none.
+func (r *registry) lookup(key string) *command {
+	return r.byKey[key]
+}
+
+func (s *session) quit(args []string) error {
+	if s.modified && s.songs() > 0 {
+		return userError("Warning: bookmarks list modified")
+	}
+	return s.forceQuit(args)
+}
+
+func (s *session) forceQuit(args []string) error {
+	s.done = true
+	fmt.Println(exitMessage)
+	return nil
+}
+
+func (s *session) help(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, h := range s.km.help() {
+		if h.keys[0] == "h" {
+			continue
+		}
+		name := strings.Join(h.keys, ", ")
+		if h.usage != "" {
+			name += " " + h.usage
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, h.help)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMPD serves canned replies to MPD commands over TCP, recording the
+// commands received.
+type fakeMPD struct {
+	ln      net.Listener
+	replies map[string]string
+	mu      sync.Mutex
+	cmds    []string
+}
+
+// reply sets the reply to a command, replacing any previous one.
+func (f *fakeMPD) reply(cmd, text string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[cmd] = text
+}
+
+// count returns the number of times a command was received.
+func (f *fakeMPD) count(cmd string) int {
+	n := 0
+	for _, c := range f.received() {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+// received returns the commands received so far.
+func (f *fakeMPD) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.cmds...)
+}
+
+func (f *fakeMPD) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			fmt.Fprint(conn, "OK MPD 0.23.5\n")
+			sc := bufio.NewScanner(conn)
+			for sc.Scan() {
+				f.mu.Lock()
+				f.cmds = append(f.cmds, sc.Text())
+				reply, ok := f.replies[sc.Text()]
+				f.mu.Unlock()
+				if !ok {
+					fmt.Fprintf(conn, "ACK [5@0] {} unknown command %q\n", sc.Text())
+					continue
+				}
+				fmt.Fprint(conn, reply+"OK\n")
+			}
+		}()
+	}
+}
+
+// newTestSession returns a session whose MPD server replies with the canned
+// replies.
+func newTestSession(t *testing.T, replies map[string]string) *session {
+	s, _ := newFakeSession(t, replies)
+	return s
+}
+
+// newFakeSession is like newTestSession, also returning the MPD server.
+func newFakeSession(t *testing.T, replies map[string]string) (*session, *fakeMPD) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeMPD{ln: ln, replies: replies}
+	go f.serve()
+
+	mp := mpd.NewClient("127.0.0.1", ln.Addr().(*net.TCPAddr).Port)
+	t.Cleanup(func() { mp.Close() })
+	reg := newRegistry(commands)
+	km, err := newKeymap(reg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := (&config.Settings{}).FindProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &session{
+		bms:     make(types.BookmarkSet),
+		mp:      mp,
+		pmp:     mp,
+		sched:   newScheduler(mp, modeFile, 0, false),
+		unwatch: func() {},
+		prof:    prof,
+		reg:     reg,
+		km:      km,
+	}, f
+}
+
+const playingSong = `file: a.mp3
+Id: 1
+Pos: 0
+Time: 200
+duration: 200.0
+`
+
+func Test_registry_find(t *testing.T) {
+	reg := newRegistry(commands)
+	tests := []struct {
+		line string
+		key  string
+		args []string
+	}{
+		{"q", "q", []string{}},
+		{"o", "o", []string{""}},
+		{"o shuffle", "o", []string{"shuffle"}},
+		{"open best", "open", []string{"best"}},
+		{"outputs", "outputs", []string{}},
+		{"output 1 on", "output", []string{"1", "on"}},
+		{",p", "p", []string{}},
+		{"d3", "d", []string{"3"}},
+		{"d 3", "d", []string{"3"}},
+		{"c1 01:00-01:30", "c", []string{"1", "01:00-01:30"}},
+		{"c 3 +0.5", "c", []string{"3", "+0.5"}},
+		{"f", "f", []string{""}},
+		{"f 30", "f", []string{"30"}},
+		{"[ 01:02.5", "[", []string{"01:02.5"}},
+		{"] -2", "]", []string{"-2"}},
+		{"loop 2", "loop", []string{"2", ""}},
+		{"sel -", "sel", []string{"-"}},
+		{"rate 1 9", "", nil},
+		{"qq", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			cmd, args := reg.find(tt.line)
+			if tt.key == "" {
+				assert.Nil(t, cmd)
+				return
+			}
+			if assert.NotNil(t, cmd) {
+				assert.Equal(t, tt.key, cmd.key)
+				assert.Equal(t, tt.args, args)
+			}
+		})
+	}
+}
+
+func Test_newRegistry(t *testing.T) {
+	assert.Panics(t, func() {
+		newRegistry([]*command{{key: "a"}, {key: "b", alt: []string{"a"}}})
+	})
+}
+
+func Test_session_bookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, map[string]string{"currentsong": playingSong})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "01:00", End: "01:10"}}
+
+	assert.Equal(errMissingPos, (*session).deleteBookmark(s, []string{""}))
+	assert.Equal(errOutOfRange, (*session).deleteBookmark(s, []string{"3"}))
+	assert.False(s.modified)
+
+	assert.NoError((*session).rate(s, []string{"2", "4"}))
+	assert.Equal(4, s.bms["a.mp3"][1].Rating)
+	assert.True(s.modified)
+
+	assert.NoError((*session).changeBookmark(s, []string{"1", "00:15-01:05"}))
+	assert.Equal([]types.Bookmark{{Start: "00:15", End: "01:10", Rating: 4}}, s.bms["a.mp3"])
+
+	assert.Equal(userError("start can't be greater than the song's length"),
+		(*session).changeBookmark(s, []string{"1", "04:00-04:10"}))
+
+	assert.NoError((*session).changeBookmark(s, []string{"1", "+0.5"}))
+	assert.Equal("00:15.5", s.bms["a.mp3"][0].Start)
+	assert.NoError((*session).changeBookmark(s, []string{"1", "+0 -2"}))
+	assert.Equal([]types.Bookmark{{Start: "00:15.5", End: "01:08", Rating: 4}}, s.bms["a.mp3"])
+	assert.Equal(userError("end time must be after start"),
+		(*session).changeBookmark(s, []string{"1", "02:00"}))
+
+	assert.NoError((*session).deleteBookmark(s, []string{"1"}))
+	assert.Empty(s.bms["a.mp3"])
+	assert.NoError((*session).deleteAllBookmarks(s, nil))
+	assert.Equal(errNoBookmark, (*session).deleteAllBookmarks(s, nil))
+}
+
+func Test_session_exec(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, map[string]string{
+		"currentsong": playingSong,
+		"status":      "state: pause\nelapsed: 12.0\nduration: 200.0\n",
+	})
+	s.exec("[")
+	assert.False(s.bOpen, "not playing")
+	s.exec("[ 01:02.5")
+	assert.True(s.bOpen, "explicit time")
+	s.exec("] 01:10")
+	assert.False(s.bOpen)
+	assert.Equal([]types.Bookmark{{Start: "01:02.5", End: "01:10", Tags: types.SongTags{Duration: 200}}}, s.bms["a.mp3"])
+	s.exec("[ 04:00")
+	assert.False(s.bOpen, "past the end")
+
+	s.bms["b.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	s.modified = true
+	s.exec("q")
+	assert.False(s.done, "unsaved changes")
+	s.exec("Q")
+	assert.True(s.done)
+}
+
+func Test_session_preview(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, map[string]string{
+		"currentsong": playingSong,
+		"status":      "state: play\nelapsed: 25.0\nduration: 200.0\nvolume: -1\n",
+		"seekcur 10":  "",
+		"pause 0":     "",
+		"pause 1":     "",
+	})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+
+	assert.Equal(errOutOfRange, (*session).playRange(s, []string{"2"}))
+	assert.NoError((*session).playRange(s, []string{"1"}))
+	assert.True(s.sched.previewing())
+
+	// Seeks to the start of the range first.
+	assert.NoError(s.sched.tick())
+	assert.True(s.sched.previewing())
+	// Then pauses once past its end.
+	assert.NoError(s.sched.tick())
+	assert.False(s.sched.previewing())
+	assert.False(s.sched.running())
+
+	s.bms["a.mp3"] = nil
+	assert.Equal(errNoBookmark, (*session).preview(s, nil))
+}
+
+func Test_session_previewCleanQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		"currentsong":             playingSong,
+		"status":                  "state: play\nelapsed: 25.0\nduration: 200.0\nvolume: -1\n",
+		"seekcur 10":              "",
+		"pause 0":                 "",
+		"clear":                   "",
+		`load "bmp-queue-backup"`: "",
+		`rm "bmp-queue-backup"`:   "",
+		"stop":                    "",
+	})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	// Autoplaying in a clean queue.
+	s.sched.clean = true
+	s.sched.queue = &queueState{state: "stop"}
+	s.sched.start([]part{{song: "a.mp3", start: 10, end: 20}}, "a.mp3")
+
+	assert.NoError((*session).preview(s, nil))
+	assert.NotNil(s.sched.queue, "kept while previewing")
+	assert.NoError(s.sched.tick())
+	assert.NoError(s.sched.tick())
+	assert.False(s.sched.running())
+	assert.Nil(s.sched.queue, "restored at the end")
+	assert.Subset(f.received(), []string{"clear", `load "bmp-queue-backup"`, `rm "bmp-queue-backup"`})
+	assert.NotContains(f.received(), "pause 1")
+}
+
+func Test_session_previewStopped(t *testing.T) {
+	s := newTestSession(t, map[string]string{
+		"currentsong": playingSong,
+		"status":      "state: stop\n",
+	})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	assert.Equal(t, errNotPlaying, (*session).preview(s, nil))
+	assert.False(t, s.sched.running())
+}
+
+func Test_session_startSong(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		`playlistfind "(file == 'b.mp3')"`: "",
+		`addid "b.mp3"`:                    "Id: 7\n",
+		"playid 7":                         "",
+	})
+	s.results = []string{"a.mp3", "b.mp3"}
+
+	assert.Equal(errNoSuchSong, (*session).startSong(s, []string{"3"}))
+	assert.NoError((*session).startSong(s, []string{"2"}))
+	f.reply(`playlistfind "(file == 'b.mp3')"`, "file: b.mp3\nPos: 0\nId: 7\n")
+	assert.NoError((*session).startSong(s, []string{"2"}))
+	assert.Equal(1, f.count(`addid "b.mp3"`), "queued once")
+	assert.Equal(2, f.count("playid 7"))
+}
+
+func Test_session_listAll(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		`find "(file == 'a.mp3')"`:         "file: a.mp3\nArtist: Metallica\nTitle: One\n",
+		`find "(file == 'b.mp3')"`:         "",
+		`playlistfind "(file == 'b.mp3')"`: "",
+		`addid "b.mp3"`:                    "Id: 7\n",
+		"seekid 7 60":                      "",
+		"seekid 7 30":                      "",
+	})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	s.bms["b.mp3"] = []types.Bookmark{{Start: "00:30", End: "00:40"}, {Start: "01:00", End: "01:10"}}
+	s.order = []string{"b.mp3", "a.mp3"}
+
+	assert.NoError((*session).listAll(s, []string{""}))
+	assert.Equal([]string{"b.mp3", "a.mp3"}, s.results)
+	assert.NoError((*session).listAll(s, []string{"metal"}))
+	assert.Equal([]string{"a.mp3"}, s.results)
+	assert.NoError((*session).listAll(s, []string{"B.MP3"}))
+	assert.Equal([]string{"b.mp3"}, s.results)
+
+	assert.Equal(errNoSuchSong, (*session).jump(s, []string{"2", ""}))
+	assert.Equal(errOutOfRange, (*session).jump(s, []string{"1", "3"}))
+	assert.NoError((*session).jump(s, []string{"1", "2"}))
+
+	// Jumping again reuses the queued song.
+	f.reply(`playlistfind "(file == 'b.mp3')"`, "file: b.mp3\nPos: 0\nId: 7\n")
+	s.exec("goto 1 1")
+	s.exec("goto 1 1")
+	assert.Equal(1, f.count(`addid "b.mp3"`))
+	assert.Equal(2, f.count("seekid 7 30"))
+}
+
+func Test_session_selectSong(t *testing.T) {
+	assert := assert.New(t)
+
+	// MPD is stopped.
+	s := newTestSession(t, map[string]string{"currentsong": ""})
+	s.bms["b.mp3"] = []types.Bookmark{
+		{Start: "00:30", End: "00:40", Tags: types.SongTags{Duration: 90}},
+		{Start: "01:00", End: "01:10", Tags: types.SongTags{Duration: 90}},
+	}
+	s.results = []string{"a.mp3", "b.mp3"}
+
+	assert.Equal(errNoSuchSong, (*session).selectSong(s, []string{"3"}))
+	assert.Equal(userError(`no bookmarks for "a.mp3"`), (*session).selectSong(s, []string{"1"}))
+	assert.NoError((*session).selectSong(s, []string{"2"}))
+	assert.Equal("b.mp3", s.selected)
+
+	assert.NoError((*session).changeBookmark(s, []string{"2", "+5"}))
+	assert.Equal("01:05", s.bms["b.mp3"][1].Start)
+	assert.Equal(userError("start can't be greater than the song's length"),
+		(*session).changeBookmark(s, []string{"2", "02:00-02:10"}))
+	_, err := s.nudge(&types.Song{File: "b.mp3"}, 0, edgeEnd, 1)
+	assert.NoError(err)
+	assert.NoError((*session).nudgeEnd(s, []string{"1", ""}))
+	assert.Equal("00:41.5", s.bms["b.mp3"][0].End)
+	assert.NoError((*session).deleteBookmark(s, []string{"1"}))
+	assert.Len(s.bms["b.mp3"], 1)
+	assert.NoError((*session).deleteAllBookmarks(s, nil))
+	assert.Empty(s.bms)
+	assert.Equal("", s.selected, "song deleted")
+	assert.Error((*session).deleteAllBookmarks(s, nil))
+
+	// Song gone once the last edit is undone.
+	s.bms["c.mp3"] = []types.Bookmark{{Start: "00:30", End: "00:40"}}
+	s.undo = []snapshot{{bms: types.BookmarkSet{}}}
+	assert.NoError((*session).selectSong(s, []string{"c.mp3"}))
+	assert.NoError((*session).undoEdit(s, nil))
+	assert.Equal("", s.selected)
+
+	assert.NoError((*session).selectSong(s, []string{"-"}))
+	assert.Equal("", s.selected)
+}
+
+func Test_session_offline(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{"currentsong": playingSong})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	s.offline, s.reachable = true, make(chan struct{})
+
+	s.exec("r")
+	assert.False(s.sched.running(), "not available offline")
+	s.exec("c 1 00:12-00:20")
+	assert.Equal("00:10", s.bms["a.mp3"][0].Start, "no song selected")
+	s.exec("sel a.mp3")
+	s.exec("c 1 00:12-00:20")
+	assert.Equal("00:12", s.bms["a.mp3"][0].Start)
+	s.exec("{ 1")
+	s.exec("all")
+	s.exec("marked")
+	assert.Empty(f.received(), "MPD not queried offline")
+
+	close(s.reachable)
+	s.exec("r")
+	assert.False(s.offline)
+	assert.True(s.sched.running())
+}
+
+func Test_session_reload(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "best.txt"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("song: a.mp3\n00:10-00:20\nsong: b.mp3\n00:10-00:20\n")
+	s := newTestSession(t, nil)
+	s.st, s.storeKind = config.NewFileStore(dir), storeFile
+	// Songs are not resolved offline.
+	s.offline = true
+	if err := s.load("best.txt"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.unwatch()
+
+	s.selected = "b.mp3"
+	write("song: a.mp3\n00:10-00:30\n")
+	assert.NoError(s.reload())
+	assert.Equal("00:30", s.bms["a.mp3"][0].End, "reloaded")
+	assert.Equal("", s.selected, "removed in storage")
+	assert.False(s.modified)
+
+	s.bms["a.mp3"][0].End = "00:40"
+	s.bms["c.mp3"] = []types.Bookmark{{Start: "00:01", End: "00:02"}}
+	s.order = append(s.order, "c.mp3")
+	s.modified = true
+	write("song: b.mp3\n00:15-00:20\nsong: a.mp3\n00:10-00:35\n")
+	s.p = &answers{"y"}
+	assert.NoError(s.reload())
+	assert.Equal("00:40", s.bms["a.mp3"][0].End, "ours kept")
+	assert.Equal("00:15", s.bms["b.mp3"][0].Start, "theirs")
+	assert.Contains(s.bms, "c.mp3")
+	assert.Equal([]string{"b.mp3", "a.mp3", "c.mp3"}, s.order)
+	assert.True(s.modified)
+
+	assert.NoError(s.save())
+	assert.False(s.modified)
+	assert.Equal(s.bms, s.base)
+
+	// A range being marked is an unsaved change.
+	s.bms["c.mp3"] = append(s.bms["c.mp3"], types.Bookmark{Start: "00:05"})
+	s.bOpen = true
+	write("song: b.mp3\n00:15-00:25\nsong: a.mp3\n00:10-00:40\nsong: c.mp3\n00:01-00:02\n")
+	assert.NoError(s.reload())
+	assert.Equal("00:25", s.bms["b.mp3"][0].End, "theirs")
+	if assert.Len(s.bms["c.mp3"], 2) {
+		assert.Equal(types.Bookmark{Start: "00:05"}, s.bms["c.mp3"][1], "open range kept")
+	}
+	assert.True(s.bOpen)
+
+	// Dropped along with our ranges.
+	write("song: b.mp3\n00:15-00:25\nsong: a.mp3\n00:10-00:40\nsong: c.mp3\n00:01-00:03\n")
+	s.p = &answers{"n"}
+	assert.NoError(s.reload())
+	assert.Equal([]types.Bookmark{{Start: "00:01", End: "00:03"}}, s.bms["c.mp3"])
+	assert.False(s.bOpen)
+}
+
+func Test_session_loadResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "best.txt"), []byte("song: a.mp3\n00:10-00:20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, f := newFakeSession(t, map[string]string{
+		`find "(file == 'a.mp3')"`: "file: a.mp3\n",
+	})
+	s.st, s.storeKind = config.NewFileStore(dir), storeFile
+	s.autoResolve = true
+	s.offline, s.reachable = true, make(chan struct{})
+	if err := s.load("best.txt"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.unwatch()
+	assert.True(s.resolvePending, "once online")
+	assert.Empty(f.received())
+
+	close(s.reachable)
+	s.checkOnline()
+	assert.False(s.resolvePending)
+	assert.Equal([]string{`find "(file == 'a.mp3')"`}, f.received())
+
+	assert.NoError(s.load("best.txt"))
+	assert.Len(f.received(), 2, "resolved on load")
+}
+
+func Test_scheduler_cleanQueueEnd(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		"currentsong":             playingSong,
+		"status":                  "state: play\nelapsed: 25.0\nduration: 200.0\nvolume: -1\n",
+		"seekcur 10":              "",
+		"clear":                   "",
+		`load "bmp-queue-backup"`: "",
+		`rm "bmp-queue-backup"`:   "",
+		"stop":                    "",
+	})
+	s.sched.clean = true
+	// The user's queue, saved when autoplay started.
+	s.sched.queue = &queueState{state: "stop"}
+	s.sched.start([]part{{song: "a.mp3", start: 10, end: 20}}, "a.mp3")
+
+	assert.NoError(s.sched.tick())
+	assert.NoError(s.sched.tick())
+	assert.False(s.sched.running(), "end of parts")
+	assert.Nil(s.sched.queue)
+	assert.Subset(f.received(), []string{"clear", `load "bmp-queue-backup"`, `rm "bmp-queue-backup"`, "stop"})
+}
+
+func Test_session_partition(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, map[string]string{
+		"currentsong":    playingSong,
+		"status":         "state: play\nelapsed: 12.0\nduration: 200.0\n",
+		"seekcur 10":     "",
+		"pause 0":        "",
+		"outputs":        "outputid: 0\noutputname: My ALSA\nplugin: alsa\noutputenabled: 1\n",
+		"toggleoutput 0": "",
+	})
+	// The player runs in its own partition, the default one must not be
+	// used.
+	s.mp = mpd.NewClient("127.0.0.1", 1)
+	t.Cleanup(func() { s.mp.Close() })
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}}
+
+	assert.NoError((*session).songInfo(s, nil))
+	assert.NoError((*session).markStart(s, []string{""}))
+	assert.NoError((*session).markEnd(s, []string{"00:30"}))
+	assert.NoError((*session).playRange(s, []string{"1"}))
+	assert.NoError((*session).run(s, nil))
+	assert.NoError((*session).switchOutput(s, []string{"0", ""}))
+}
+
+func Test_session_useProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, nil)
+	s.settings = &config.Settings{Profiles: map[string]config.Profile{
+		"away": {Host: "127.0.0.1", Port: 1},
+	}}
+	s.profile = "home"
+	assert.Error((*session).useProfile(s, []string{"away"}))
+	assert.Equal("home", s.profile, "unchanged")
+}
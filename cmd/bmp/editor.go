@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// Editor run when $EDITOR is not set.
+const defaultEditor = "vi"
+
+// snapshot is the state of the bookmarks before a change, restored by the
+// undo command.
+type snapshot struct {
+	bms      types.BookmarkSet
+	order    []string
+	modified bool
+}
+
+// editorCommand returns the command running the user's editor on a file.
+func editorCommand(filename string) *exec.Cmd {
+	args := strings.Fields(os.Getenv("EDITOR"))
+	if len(args) == 0 {
+		args = []string{defaultEditor}
+	}
+	cmd := exec.Command(args[0], append(args[1:], filename)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd
+}
+
+// editFile runs the user's editor on a file until its content is valid or
+// the user gives up. Returns the bookmarks read from the file and false if
+// the file was left unchanged.
+func (s *session) editFile(filename string) (types.BookmarkSet, []string, bool, error) {
+	orig, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, false, eris.Wrap(err, "edit bookmarks")
+	}
+	for {
+		if err := editorCommand(filename).Run(); err != nil {
+			return nil, nil, false, eris.Wrap(err, "editor")
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, nil, false, eris.Wrap(err, "edit bookmarks")
+		}
+		if bytes.Equal(data, orig) {
+			return nil, nil, false, nil
+		}
+		bs, order, err := config.ParseBookmarkFileOrdered(bytes.NewReader(data))
+		if err == nil {
+			return bs, order, true, nil
+		}
+		fmt.Printf("error: %v\n", err)
+		if !confirm(s.p, "Edit again?") {
+			return nil, nil, false, userError("edit aborted, bookmarks unchanged")
+		}
+	}
+}
+
+// editAll edits all bookmarks as a bookmarks file in the user's editor,
+// replacing them once the file is valid. Undone with the undo command.
+func (s *session) editAll(args []string) error {
+	if _, ok := s.p.(*screen); ok {
+		return userError("not available in the full-screen UI")
+	}
+	if s.bOpen {
+		return errOpenRange
+	}
+	f, err := os.CreateTemp("", "bmp-*.txt")
+	if err != nil {
+		return eris.Wrap(err, "edit bookmarks")
+	}
+	defer os.Remove(f.Name())
+	s.mu.Lock()
+	// Songs left without ranges would not parse back.
+	bs := make(types.BookmarkSet)
+	for song, bms := range s.bms {
+		if len(bms) > 0 {
+			bs[song] = bms
+		}
+	}
+	_, err = config.WriteBookmarkFile(f, bs, s.order)
+	s.mu.Unlock()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	bs, order, changed, err := s.editFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Println("no changes")
+		return nil
+	}
+	printChanges(config.NormalizeBookmarkSet(bs))
+	s.mu.Lock()
+	s.undo = append(s.undo, snapshot{bms: s.bms, order: s.order, modified: s.modified})
+	s.bms, s.order = bs, order
+	s.checkSelected()
+	s.mu.Unlock()
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+// undoEdit restores the bookmarks as they were before the last edit made in
+// the user's editor.
+func (s *session) undoEdit(args []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.undo) == 0 {
+		return userError("nothing to undo")
+	}
+	last := s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+	s.bms, s.order, s.modified = last.bms, last.order, last.modified
+	s.checkSelected()
+	fmt.Println("bookmarks restored")
+	return nil
+}
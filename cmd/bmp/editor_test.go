@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// answers replies to questions in turn.
+type answers []string
+
+func (a *answers) Input() string {
+	if len(*a) == 0 {
+		return ""
+	}
+	ans := (*a)[0]
+	*a = (*a)[1:]
+	return ans
+}
+
+// fakeEditor sets $EDITOR to a script replacing the edited file with
+// contents, one per run.
+func fakeEditor(t *testing.T, contents ...string) {
+	dir := t.TempDir()
+	for k, c := range contents {
+		if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(k+1)), []byte(c), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	script := fmt.Sprintf(`#!/bin/sh
+n=$(($(cat %[1]s/runs 2>/dev/null || echo 0) + 1))
+echo $n > %[1]s/runs
+cp %[1]s/$n "$1"
+`, dir)
+	editor := filepath.Join(dir, "editor")
+	if err := os.WriteFile(editor, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", editor)
+}
+
+func Test_session_editAll(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, nil)
+	orig := []types.Bookmark{{Start: "00:10", End: "00:20"}}
+	s.bms["a.mp3"] = orig
+	s.order = []string{"a.mp3"}
+
+	fakeEditor(t, "song: a.mp3\n00:10-00:20\n")
+	assert.NoError((*session).editAll(s, nil))
+	assert.False(s.modified, "no changes")
+
+	// Fixed after an error.
+	fakeEditor(t, "00:30-00:40\n", "song: b.mp3\n00:30-00:40\n00:35-00:50\n")
+	s.p = &answers{"y"}
+	assert.NoError((*session).editAll(s, nil))
+	assert.True(s.modified)
+	assert.Equal(types.BookmarkSet{"b.mp3": {{Start: "00:30", End: "00:50"}}}, s.bms)
+	assert.Equal([]string{"b.mp3"}, s.order)
+
+	fakeEditor(t, "00:30-00:40\n")
+	s.p = &answers{"n"}
+	assert.Error((*session).editAll(s, nil))
+	assert.Contains(s.bms, "b.mp3", "aborted")
+
+	assert.NoError((*session).undoEdit(s, nil))
+	assert.Equal(types.BookmarkSet{"a.mp3": orig}, s.bms)
+	assert.False(s.modified)
+	assert.Equal(userError("nothing to undo"), (*session).undoEdit(s, nil))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// keymap holds the user's key bindings and command aliases, read from the
+// configuration file.
+type keymap struct {
+	reg *registry
+	// Extra key of a command, by command key, e.g. "m" for "[".
+	keys map[string]string
+	// Command line run by an alias, e.g. "f 30" for "ff".
+	aliases map[string]string
+}
+
+// newKeymap checks the key bindings and aliases of the configuration file.
+// Bound keys must be commands, and neither keys nor aliases may shadow a
+// command.
+func newKeymap(reg *registry, keys, aliases map[string]string) (*keymap, error) {
+	known := reg.has
+	km := &keymap{reg: reg, keys: make(map[string]string), aliases: make(map[string]string)}
+	for key, cmd := range keys {
+		if !known(cmd) {
+			return nil, fmt.Errorf("key %q bound to unknown command %q", key, cmd)
+		}
+		if known(key) || strings.ContainsAny(key, " \t") || key == "" {
+			return nil, fmt.Errorf("can't bind key %q to %q: not a free key", key, cmd)
+		}
+		km.keys[key] = cmd
+	}
+	for name, line := range aliases {
+		if known(name) || km.keys[name] != "" || strings.ContainsAny(name, " \t") || name == "" {
+			return nil, fmt.Errorf("can't define alias %q: not a free name", name)
+		}
+		km.aliases[name] = line
+	}
+	return km, nil
+}
+
+// expand returns the command line run by line: aliases are replaced with
+// their command line, followed by any argument given, and bound keys with
+// the key of their command. Like command keys, a bound key can be glued to
+// its first argument, e.g. "x3" for "d3" if x is bound to d.
+func (km *keymap) expand(line string) string {
+	word, args := line, ""
+	if k := strings.IndexAny(line, " \t"); k >= 0 {
+		word, args = line[:k], line[k:]
+	}
+	if alias, ok := km.aliases[word]; ok {
+		line = alias + args
+		word, args = line, ""
+		if k := strings.IndexAny(line, " \t"); k >= 0 {
+			word, args = line[:k], line[k:]
+		}
+	}
+	if cmd, ok := km.keys[word]; ok {
+		return cmd + args
+	}
+	if cmd, _ := km.reg.find(line); cmd != nil {
+		return line
+	}
+	// Longest bound key glued to an argument.
+	glued := ""
+	for key := range km.keys {
+		if len(key) > len(glued) && strings.HasPrefix(word, key) {
+			if cmd, _ := km.reg.find(km.keys[key] + line[len(key):]); cmd != nil {
+				glued = key
+			}
+		}
+	}
+	if glued != "" {
+		return km.keys[glued] + line[len(glued):]
+	}
+	return line
+}
+
+// keysOf returns the keys running a command, its own keys first.
+func (km *keymap) keysOf(cmd string) []string {
+	keys := []string{cmd}
+	if c := km.reg.lookup(cmd); c != nil {
+		keys = append([]string{c.key}, c.alt...)
+	}
+	extra := make([]string, 0)
+	for key, c := range km.keys {
+		if c == keys[0] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	return append(keys, extra...)
+}
+
+// aliasNames returns the names of all aliases, sorted.
+func (km *keymap) aliasNames() []string {
+	names := make([]string, 0, len(km.aliases))
+	for name := range km.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandHelp is the help of a command, or alias, as listed by h and
+// suggested by the completer.
+type commandHelp struct {
+	keys  []string
+	usage string
+	help  string
+}
+
+// help returns the help of all commands with their active keys, then of all
+// aliases.
+func (km *keymap) help() []commandHelp {
+	res := make([]commandHelp, 0, len(km.reg.cmds)+len(km.aliases))
+	for _, cmd := range km.reg.cmds {
+		res = append(res, commandHelp{km.keysOf(cmd.key), cmd.usage, cmd.help})
+	}
+	for _, name := range km.aliasNames() {
+		res = append(res, commandHelp{[]string{name}, "", fmt.Sprintf("Alias of '%s'", km.aliases[name])})
+	}
+	return res
+}
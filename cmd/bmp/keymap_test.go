@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newKeymap(t *testing.T) {
+	assert := assert.New(t)
+	reg := newRegistry(commands)
+
+	_, err := newKeymap(reg, map[string]string{"m": "nope"}, nil)
+	assert.Error(err)
+	_, err = newKeymap(reg, map[string]string{"f": "b"}, nil)
+	assert.Error(err, "shadows a command")
+	_, err = newKeymap(reg, nil, map[string]string{"r": "s"})
+	assert.Error(err, "shadows a command")
+	_, err = newKeymap(reg, map[string]string{"m": "["}, map[string]string{"m": "]"})
+	assert.Error(err, "shadows a key")
+	_, err = newKeymap(reg, nil, map[string]string{"a b": "f"})
+	assert.Error(err)
+
+	km, err := newKeymap(reg, map[string]string{"m": "[", "M": "]", ",": "]"}, map[string]string{"sr": "search", "mm": "m"})
+	assert.NoError(err)
+	assert.Equal([]string{"]", ",", "M"}, km.keysOf("]"))
+	assert.Equal([]string{"f"}, km.keysOf("f"))
+	assert.Equal([]string{"p", ",p"}, km.keysOf("p"))
+	assert.Equal([]string{"mm", "sr"}, km.aliasNames())
+}
+
+func Test_keymap_expand(t *testing.T) {
+	reg := newRegistry(commands)
+	km, err := newKeymap(reg, map[string]string{"m": "[", "M": "]", "x": "d", "xx": "D"}, map[string]string{
+		"sr": "search",
+		"ff": "f 30",
+		"mm": "m",
+	})
+	assert.NoError(t, err)
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"", ""},
+		{"f", "f"},
+		{"m", "["},
+		{"M", "]"},
+		{"m 01:02", "[ 01:02"},
+		{"sr", "search"},
+		{"sr metallica one", "search metallica one"},
+		{"ff", "f 30"},
+		{"mm", "["},
+		{"mmm", "mmm"},
+		{"x3", "d3"},
+		{"x 3", "d 3"},
+		{"xx", "D"},
+		{"xy", "xy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			assert.Equal(t, tt.want, km.expand(tt.line))
+		})
+	}
+}
+
+func Test_session_execKeymap(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		"seekcur +30": "",
+	})
+	km, err := newKeymap(s.reg, map[string]string{"x": "d"}, map[string]string{"ff": "f 30"})
+	assert.NoError(err)
+	s.km = km
+	s.exec("ff")
+	assert.Equal([]string{"seekcur +30"}, f.received())
+
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "00:30", End: "00:40"}}
+	s.selected = "a.mp3"
+	s.exec("x2")
+	assert.Equal([]types.Bookmark{{Start: "00:10", End: "00:20"}}, s.bms["a.mp3"])
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+)
+
+// songLabel returns a short description of a song, from its tags if any.
+func songLabel(s types.Song) string {
+	switch {
+	case s.Artist != "" && s.Title != "":
+		return fmt.Sprintf("%s - %s", s.Artist, s.Title)
+	case s.Title != "":
+		return s.Title
+	}
+	return s.File
+}
+
+// printSongs prints a numbered list of songs, the ones having bookmarks
+// being flagged with a star. Returns the song paths, in the same order.
+func printSongs(songs []types.Song, bms types.BookmarkSet) []string {
+	paths := make([]string, 0, len(songs))
+	for k, s := range songs {
+		flag := " "
+		if len(bms[s.File]) > 0 {
+			flag = "*"
+		}
+		label := songLabel(s)
+		if label != s.File {
+			label = fmt.Sprintf("%s (%s)", label, s.File)
+		}
+		fmt.Printf("%3d %s %s\n", k+1, flag, label)
+		paths = append(paths, s.File)
+	}
+	if len(songs) == 0 {
+		fmt.Println("no songs found")
+	}
+	return paths
+}
+
+// browse prints the directories and songs of a directory of the music
+// library. Only songs are numbered. Returns the song paths.
+func browse(mp *mpd.Client, dir string, bms types.BookmarkSet) ([]string, error) {
+	entries, err := mp.LsInfo(strings.Trim(dir, "/"))
+	if err != nil {
+		return nil, err
+	}
+	songs := make([]types.Song, 0)
+	for _, e := range entries {
+		switch {
+		case e.Directory:
+			fmt.Printf("      %s/\n", e.Path)
+		case e.Song != nil:
+			songs = append(songs, *e.Song)
+		}
+	}
+	if len(songs) == 0 {
+		return nil, nil
+	}
+	return printSongs(songs, bms), nil
+}
+
+// bookmarkedSongs returns the songs of the set whose path contains pattern,
+// case insensitive, in song order.
+func bookmarkedSongs(songs []string, pattern string) []types.Song {
+	pattern = strings.ToLower(pattern)
+	res := make([]types.Song, 0)
+	for _, song := range songs {
+		if strings.Contains(strings.ToLower(song), pattern) {
+			res = append(res, types.Song{File: song})
+		}
+	}
+	return res
+}
+
+// matchSong returns true if the path, artist or title of a song contains
+// pattern, case insensitive.
+func matchSong(s types.Song, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	for _, v := range []string{s.File, s.Artist, s.Title} {
+		if strings.Contains(strings.ToLower(v), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// printBookmarks prints a numbered list of songs, each followed by its
+// numbered ranges. Returns the song paths, in the same order.
+func printBookmarks(songs []types.Song, bms types.BookmarkSet) []string {
+	paths := make([]string, 0, len(songs))
+	for k, s := range songs {
+		label := songLabel(s)
+		if label != s.File {
+			label = fmt.Sprintf("%s (%s)", label, s.File)
+		}
+		fmt.Printf("%3d %s\n", k+1, label)
+		for j, bm := range bms[s.File] {
+			fmt.Printf("      %d\t%s-%s\n", j+1, bm.Start, bm.End)
+		}
+		paths = append(paths, s.File)
+	}
+	if len(songs) == 0 {
+		fmt.Println("no songs found")
+	}
+	return paths
+}
+
+// lookupSongs returns the tags of songs from the MPD database. Songs not
+// found are returned with their path only.
+func lookupSongs(mp *mpd.Client, songs []types.Song) []types.Song {
+	for k, s := range songs {
+		found, err := mp.FindSongs(map[string]string{"file": s.File})
+		if err == nil && len(found) > 0 {
+			songs[k] = found[0]
+		}
+	}
+	return songs
+}
+
+func (s *session) browse(args []string) error {
+	s.mu.Lock()
+	songs, err := browse(s.mp, args[0], s.bms)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.results = songs
+	return nil
+}
+
+func (s *session) search(args []string) error {
+	songs, err := s.mp.SearchSongs(map[string]string{"any": args[0]})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.results = printSongs(songs, s.bms)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *session) list(args []string) error {
+	var filter string
+	if args[1] != "" {
+		filter = mpd.Filter("any", "contains", args[1])
+	}
+	values, err := s.mp.List(args[0], filter)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if v != "" {
+			fmt.Println(v)
+		}
+	}
+	return nil
+}
+
+func (s *session) marked(args []string) error {
+	s.mu.Lock()
+	songs := bookmarkedSongs(config.SongOrder(s.bms, s.order), args[0])
+	s.mu.Unlock()
+	if !s.offline {
+		songs = lookupSongs(s.mp, songs)
+	}
+	s.mu.Lock()
+	s.results = printSongs(songs, s.bms)
+	s.mu.Unlock()
+	return nil
+}
+
+// listAll lists the ranges of all songs, with their tags looked up from the
+// MPD database unless offline.
+func (s *session) listAll(args []string) error {
+	s.mu.Lock()
+	songs := bookmarkedSongs(config.SongOrder(s.bms, s.order), "")
+	s.mu.Unlock()
+	if !s.offline {
+		songs = lookupSongs(s.mp, songs)
+	}
+	matching := make([]types.Song, 0, len(songs))
+	for _, song := range songs {
+		if matchSong(song, args[0]) {
+			matching = append(matching, song)
+		}
+	}
+	s.mu.Lock()
+	s.results = printBookmarks(matching, s.bms)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *session) add(args []string) error {
+	songs := s.results
+	if args[0] != "" {
+		idx, _ := strconv.Atoi(args[0])
+		if idx < 1 || idx > len(s.results) {
+			return errNoSuchSong
+		}
+		songs = s.results[idx-1 : idx]
+	}
+	added := 0
+	var err error
+	for _, song := range songs {
+		if _, err = s.pmp.AddToQueue(song); err != nil {
+			break
+		}
+		added++
+	}
+	fmt.Printf("%d songs added to the queue\n", added)
+	return err
+}
+
+func (s *session) startSong(args []string) error {
+	idx, _ := strconv.Atoi(args[0])
+	if idx < 1 || idx > len(s.results) {
+		return errNoSuchSong
+	}
+	if s.sched.running() {
+		s.sched.stop()
+		fmt.Println("autoplay stopped")
+	}
+	id, err := queueSong(s.pmp, s.results[idx-1])
+	if err != nil {
+		return err
+	}
+	return s.pmp.PlaySongID(id)
+}
+
+// queueSong returns the queue ID of song, adding it to the queue unless
+// already there.
+func queueSong(mp *mpd.Client, song string) (int64, error) {
+	id, err := mp.QueueID(song)
+	if err != nil || id >= 0 {
+		return id, err
+	}
+	return mp.AddToQueue(song)
+}
+
+// jump plays a song of the last listing, from the start of one of its ranges
+// if given.
+func (s *session) jump(args []string) error {
+	idx, _ := strconv.Atoi(args[0])
+	if idx < 1 || idx > len(s.results) {
+		return errNoSuchSong
+	}
+	song := s.results[idx-1]
+	start := 0.0
+	if args[1] != "" {
+		pos, _ := strconv.Atoi(args[1])
+		s.mu.Lock()
+		bms := s.bms[song]
+		s.mu.Unlock()
+		if pos < 1 || pos > len(bms) {
+			return errOutOfRange
+		}
+		var err error
+		if start, err = config.ParseTime(bms[pos-1].Start); err != nil {
+			return err
+		}
+	}
+	if s.sched.running() {
+		s.sched.stop()
+		fmt.Println("autoplay stopped")
+	}
+	id, err := queueSong(s.pmp, song)
+	if err != nil {
+		return err
+	}
+	return s.pmp.SeekID(id, start)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+)
+
+// volumeIndicator returns a short volume gauge, e.g. "vol [#####     ] 50%".
+// Empty if MPD has no mixer.
+func volumeIndicator(vol int64) string {
+	if vol < 0 {
+		return ""
+	}
+	n := int(vol+5) / 10
+	if n > 10 {
+		n = 10
+	}
+	return fmt.Sprintf("vol [%s%s] %d%%", strings.Repeat("#", n), strings.Repeat(" ", 10-n), vol)
+}
+
+// applyVolume sets the volume from arg: an absolute value from 0 to 100, or a
+// change relative to the current volume if prefixed with a sign.
+func applyVolume(mp *mpd.Client, arg string) error {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("wrong volume %q", arg)
+	}
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		return mp.ChangeVolume(n)
+	}
+	if n > 100 {
+		return fmt.Errorf("wrong volume %q, expecting 0 to 100", arg)
+	}
+	return mp.SetVolume(n)
+}
+
+// printOutputs lists audio outputs with their state.
+func printOutputs(outs []types.Output) {
+	for _, out := range outs {
+		state := "off"
+		if out.Enabled {
+			state = "on"
+		}
+		fmt.Printf("%2d %-3s %s (%s)\n", out.ID, state, out.Name, out.Plugin)
+	}
+}
+
+func (s *session) volume(args []string) error {
+	if args[0] != "" {
+		if err := applyVolume(s.pmp, args[0]); err != nil {
+			return err
+		}
+	}
+	vol, err := s.pmp.Volume()
+	if err != nil {
+		return err
+	}
+	if vol < 0 {
+		return userError("no mixer, volume can't be changed")
+	}
+	fmt.Println(volumeIndicator(int64(vol)))
+	return nil
+}
+
+func (s *session) outputs(args []string) error {
+	outs, err := s.pmp.Outputs()
+	if err != nil {
+		return err
+	}
+	printOutputs(outs)
+	return nil
+}
+
+func (s *session) switchOutput(args []string) error {
+	id, _ := strconv.Atoi(args[0])
+	var err error
+	switch args[1] {
+	case "on":
+		err = s.pmp.EnableOutput(id)
+	case "off":
+		err = s.pmp.DisableOutput(id)
+	default:
+		err = s.pmp.ToggleOutput(id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.outputs(nil)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_volumeIndicator(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", volumeIndicator(-1))
+	assert.Equal("vol [          ] 0%", volumeIndicator(0))
+	assert.Equal("vol [#####     ] 48%", volumeIndicator(48))
+	assert.Equal("vol [##########] 100%", volumeIndicator(100))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+	"golang.org/x/term"
+)
+
+// edge is a boundary of a range.
+type edge int
+
+const (
+	edgeStart edge = iota
+	edgeEnd
+)
+
+func (e edge) String() string {
+	if e == edgeStart {
+		return "start"
+	}
+	return "end"
+}
+
+// Shortest range left by nudging, in seconds.
+const nudgeMinRange = 0.1
+
+const editHelp = "left/right or h/l nudge, H/L ten times more, tab switches start and end, space previews, enter leaves"
+
+// nudgeRange moves a boundary of a range by delta seconds. The boundary stays
+// within the song, if its duration is known, and on its side of the other
+// boundary.
+func nudgeRange(bm types.Bookmark, e edge, delta, duration float64) (types.Bookmark, error) {
+	if bm.End == "" {
+		return bm, errOpenRange
+	}
+	start, err := config.ParseTime(bm.Start)
+	if err != nil {
+		return bm, err
+	}
+	end, err := config.ParseTime(bm.End)
+	if err != nil {
+		return bm, err
+	}
+	switch e {
+	case edgeStart:
+		start = math.Max(0, math.Min(start+delta, end-nudgeMinRange))
+	case edgeEnd:
+		end = math.Max(end+delta, start+nudgeMinRange)
+		if duration > 0 {
+			end = math.Min(end, duration)
+		}
+	}
+	bm.Start, bm.End = config.FormatTime(start), config.FormatTime(end)
+	return bm, nil
+}
+
+// nudge moves a boundary of range idx of a song by delta seconds.
+func (s *session) nudge(song *types.Song, idx int, e edge, delta float64) (types.Bookmark, error) {
+	s.mu.Lock()
+	bm, err := nudgeRange(s.bms[song.File][idx], e, delta, song.Duration)
+	if err == nil {
+		s.bms[song.File][idx] = bm
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return bm, err
+	}
+	// Mark buffer as modified.
+	s.modified = true
+	return bm, nil
+}
+
+// previewEdge plays song from a few seconds before a boundary of a range,
+// see the nudge_preroll setting of profiles. Nothing is played unless song
+// is the current one, or offline.
+func (s *session) previewEdge(song string, bm types.Bookmark, e edge) error {
+	if s.offline {
+		return nil
+	}
+	if cur, err := s.pmp.CurrentSong(); err != nil || cur.File != song {
+		return nil
+	}
+	t := bm.Start
+	if e == edgeEnd {
+		t = bm.End
+	}
+	pos, err := config.ParseTime(t)
+	if err != nil {
+		return err
+	}
+	if s.sched.running() {
+		s.sched.stop()
+		fmt.Println("autoplay stopped")
+	}
+	if err := s.pmp.SeekTo(math.Max(0, pos-s.prof.NudgePreroll)); err != nil {
+		return err
+	}
+	return s.pmp.Pause(false)
+}
+
+// normalizeSong normalizes the ranges of a song, showing the changes.
+func (s *session) normalizeSong(song string) {
+	s.mu.Lock()
+	var changes []string
+	s.bms[song], changes = config.NormalizeBookmarks(s.bms[song])
+	s.mu.Unlock()
+	printChanges(changes)
+}
+
+func (s *session) nudgeStart(args []string) error {
+	return s.nudgeEdge(edgeStart, args)
+}
+
+func (s *session) nudgeEnd(args []string) error {
+	return s.nudgeEdge(edgeEnd, args)
+}
+
+// nudgeEdge moves a boundary of a range of the edited song by a number of
+// steps, one by default, then previews it.
+func (s *session) nudgeEdge(e edge, args []string) error {
+	song, idx, err := s.bookmarkAt(args[0])
+	if err != nil {
+		return err
+	}
+	steps := 1
+	if args[1] != "" {
+		steps, _ = strconv.Atoi(args[1])
+	}
+	bm, err := s.nudge(song, idx, e, float64(steps)*s.prof.Nudge)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s-%s\n", bm.Start, bm.End)
+	s.normalizeSong(song.File)
+	return s.previewEdge(song.File, bm, e)
+}
+
+// keyReader reads single key presses.
+type keyReader interface {
+	readKey() (string, error)
+}
+
+// terminalKeys reads key presses from a terminal in raw mode.
+type terminalKeys struct {
+	in *os.File
+}
+
+func (tk terminalKeys) readKey() (string, error) {
+	return readKey(tk.in)
+}
+
+// keyInput returns a reader of single key presses along with the line ending
+// to print and a function to call once done. Keys are read by the screen if
+// the full-screen UI runs, from the terminal put in raw mode otherwise.
+func (s *session) keyInput() (keyReader, string, func(), error) {
+	if sc, ok := s.p.(*screen); ok {
+		return sc, "\n", func() {}, nil
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, "", nil, eris.Wrap(err, "terminal raw mode")
+	}
+	return terminalKeys{os.Stdin}, "\r\n", func() { term.Restore(fd, state) }, nil
+}
+
+// editRange nudges the boundaries of a range of the edited song with single
+// key presses, previewing every change.
+func (s *session) editRange(args []string) error {
+	song, idx, err := s.bookmarkAt(args[0])
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	bm := s.bms[song.File][idx]
+	s.mu.Unlock()
+	if bm.End == "" {
+		return errOpenRange
+	}
+	keys, eol, done, err := s.keyInput()
+	if err != nil {
+		return err
+	}
+	defer done()
+	// Ranges are normalized once done, since merging ranges would change
+	// their positions.
+	defer s.normalizeSong(song.File)
+
+	e := edgeStart
+	show := func() {
+		fmt.Printf("%s-%s, nudging the %s by %gs%s", bm.Start, bm.End, e, s.prof.Nudge, eol)
+	}
+	fmt.Print(editHelp + eol)
+	show()
+	preview := func() {
+		if err := s.previewEdge(song.File, bm, e); err != nil {
+			fmt.Printf("error: %v%s", err, eol)
+		}
+	}
+	preview()
+	for {
+		key, err := keys.readKey()
+		if err != nil {
+			return err
+		}
+		steps := 0
+		switch key {
+		case "\x1b[D", "h", "-":
+			steps = -1
+		case "\x1b[C", "l", "+":
+			steps = 1
+		case "H":
+			steps = -10
+		case "L":
+			steps = 10
+		case "\t", "\x1b[A", "\x1b[B":
+			e = 1 - e
+			show()
+		case " ":
+		case "\r", "\n", "q", "\x1b", "\x03":
+			return nil
+		default:
+			continue
+		}
+		if steps != 0 {
+			if bm, err = s.nudge(song, idx, e, float64(steps)*s.prof.Nudge); err != nil {
+				fmt.Printf("error: %v%s", err, eol)
+				continue
+			}
+			show()
+		}
+		preview()
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_nudgeRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		e     edge
+		delta float64
+		want  types.Bookmark
+	}{
+		{"start later", edgeStart, 0.5, types.Bookmark{Start: "00:10.5", End: "00:20"}},
+		{"start earlier", edgeStart, -1.5, types.Bookmark{Start: "00:08.5", End: "00:20"}},
+		{"start before the song", edgeStart, -30, types.Bookmark{Start: "00:00", End: "00:20"}},
+		{"start past the end", edgeStart, 30, types.Bookmark{Start: "00:19.9", End: "00:20"}},
+		{"end later", edgeEnd, 0.2, types.Bookmark{Start: "00:10", End: "00:20.2"}},
+		{"end before the start", edgeEnd, -30, types.Bookmark{Start: "00:10", End: "00:10.1"}},
+		{"end past the song", edgeEnd, 30, types.Bookmark{Start: "00:10", End: "00:25"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nudgeRange(types.Bookmark{Start: "00:10", End: "00:20"}, tt.e, tt.delta, 25)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := nudgeRange(types.Bookmark{Start: "00:10"}, edgeEnd, 1, 25)
+	assert.Equal(t, errOpenRange, err)
+}
+
+func Test_session_nudge(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newTestSession(t, map[string]string{
+		"currentsong": playingSong,
+		"seekcur 7.5": "",
+		"seekcur 18":  "",
+		"seekcur 17":  "",
+		"pause 0":     "",
+	})
+	s.bms["a.mp3"] = []types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "00:30", End: "00:40"}}
+
+	assert.NoError((*session).nudgeStart(s, []string{"1", ""}))
+	assert.Equal("00:10.5", s.bms["a.mp3"][0].Start)
+	assert.True(s.modified)
+	assert.NoError((*session).nudgeEnd(s, []string{"1", "+2"}))
+	assert.Equal("00:21", s.bms["a.mp3"][0].End)
+	// Merged with the next range.
+	assert.NoError((*session).nudgeStart(s, []string{"2", "-20"}))
+	assert.Equal([]types.Bookmark{{Start: "00:10.5", End: "00:40"}}, s.bms["a.mp3"])
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Delay between two attempts to reach MPD in offline mode.
+const reconnectDelay = 5 * time.Second
+
+// startOffline switches to offline mode, where only the commands working
+// without MPD run, until MPD is reachable again.
+func (s *session) startOffline() {
+	s.offline = true
+	s.reachable = make(chan struct{})
+	go s.waitOnline()
+}
+
+// waitOnline pings MPD until it replies.
+func (s *session) waitOnline() {
+	for {
+		time.Sleep(reconnectDelay)
+		if err := s.mp.Ping(); err == nil {
+			close(s.reachable)
+			fmt.Println("\nMPD is reachable again, going online with the next command")
+			return
+		}
+	}
+}
+
+// checkOnline goes back to online mode once MPD is reachable, completing the
+// setup skipped while offline.
+func (s *session) checkOnline() {
+	if !s.offline {
+		return
+	}
+	select {
+	case <-s.reachable:
+	default:
+		return
+	}
+	s.offline = false
+	fmt.Println("Back to online mode")
+	if s.partition != "" {
+		if err := usePartition(s.pmp, s.partition, s.output); err != nil {
+			logError(err)
+		}
+	}
+	if s.resolvePending {
+		s.resolvePending = false
+		if err := s.resolve(); err != nil {
+			logError(err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/rotisserie/eris"
+)
+
+// usePartition switches mp to the given MPD partition, created if missing,
+// and moves output to it so that the partition can be heard. An empty output
+// leaves outputs untouched.
+func usePartition(mp *mpd.Client, name, output string) error {
+	names, err := mp.Partitions()
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, n := range names {
+		if n == name {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		if err := mp.NewPartition(name); err != nil {
+			return err
+		}
+	}
+	if err := mp.SwitchPartition(name); err != nil {
+		return err
+	}
+	if output == "" {
+		return nil
+	}
+	return eris.Wrapf(mp.MoveOutput(output), "output %q", output)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/matm/bmp/pkg/types"
+)
+
+func (s *session) songInfo(args []string) error {
+	song, err := s.pmp.CurrentSong()
+	if err != nil {
+		return err
+	}
+	st, err := s.pmp.Status()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%s] %s: %s\n", st.State, song.Artist, song.Title)
+	// Display a status bar.
+	printStatusBar(st.Elapsed, st.Duration, s.bookmarks(song.File))
+	if vol := volumeIndicator(st.Volume); vol != "" {
+		fmt.Println(vol)
+	}
+	return nil
+}
+
+// seekStep returns the length of a seek: the time given, or the seek step
+// of the profile.
+func (s *session) seekStep(arg string) (float64, error) {
+	if arg == "" {
+		return float64(s.prof.Seek), nil
+	}
+	step, err := parseDuration(arg)
+	if err != nil {
+		return 0, userError(err.Error())
+	}
+	return step, nil
+}
+
+func (s *session) forward(args []string) error {
+	step, err := s.seekStep(args[0])
+	if err != nil {
+		return err
+	}
+	return s.pmp.SeekOffset(step)
+}
+
+func (s *session) backward(args []string) error {
+	step, err := s.seekStep(args[0])
+	if err != nil {
+		return err
+	}
+	st, err := s.pmp.Status()
+	if err != nil {
+		return err
+	}
+	// Seek to absolute time. Relative backward seeking not working as expected, whereas
+	// forward seeking works well.
+	return s.pmp.SeekTo(math.Max(0, st.Elapsed-step))
+}
+
+// goTo seeks to a time of the current song, relative to the current position
+// if signed.
+func (s *session) goTo(args []string) error {
+	te, err := parseTimeExpr(args[0])
+	if err != nil {
+		return userError(err.Error())
+	}
+	st, err := s.pmp.Status()
+	if err != nil {
+		return err
+	}
+	pos := te.at(st.Elapsed)
+	if pos > st.Duration {
+		return errPastEnd
+	}
+	return s.pmp.SeekTo(pos)
+}
+
+func (s *session) toggle(args []string) error {
+	return s.pmp.Toggle()
+}
+
+// run starts the autoplay, from the current song if it has bookmarks.
+func (s *session) run(args []string) error {
+	var current string
+	if song, err := s.pmp.CurrentSong(); err == nil {
+		current = song.File
+	}
+	s.mu.Lock()
+	parts := collectParts(s.bms, s.order)
+	s.mu.Unlock()
+	n := s.sched.start(parts, current)
+	if n == 0 {
+		return userError("no bookmarks to play")
+	}
+	fmt.Printf("Playing %d parts, %s order\n", n, s.sched.currentMode())
+	return nil
+}
+
+// songParts returns the parts of the current song.
+func (s *session) songParts() ([]part, error) {
+	song, err := s.pmp.CurrentSong()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return collectParts(types.BookmarkSet{song.File: s.bms[song.File]}, nil), nil
+}
+
+// playRange plays a range of the current song once.
+func (s *session) playRange(args []string) error {
+	parts, err := s.songParts()
+	if err != nil {
+		return err
+	}
+	idx, _ := strconv.Atoi(args[0])
+	idx--
+	if idx > len(parts)-1 || idx < 0 {
+		return errOutOfRange
+	}
+	return s.startPreview(parts[idx : idx+1])
+}
+
+// preview plays all ranges of the current song once, in order.
+func (s *session) preview(args []string) error {
+	parts, err := s.songParts()
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return errNoBookmark
+	}
+	fmt.Printf("Previewing %d parts\n", len(parts))
+	return s.startPreview(parts)
+}
+
+// startPreview plays parts once, replacing any autoplay. Playback resumes from
+// the first part if paused.
+func (s *session) startPreview(parts []part) error {
+	st, err := s.pmp.Status()
+	if err == types.ErrNoSong || err == nil && st.State != "play" && st.State != "pause" {
+		return errNotPlaying
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.pmp.SeekTo(parts[0].start); err != nil {
+		return err
+	}
+	s.sched.preview(parts)
+	return s.pmp.Pause(false)
+}
+
+func (s *session) stop(args []string) error {
+	s.sched.stop()
+	return nil
+}
+
+func (s *session) playOrder(args []string) error {
+	if args[0] == "" {
+		fmt.Println(s.sched.currentMode())
+		return nil
+	}
+	pm, err := parsePlayMode(args[0])
+	if err != nil {
+		return userError(err.Error())
+	}
+	s.sched.setMode(pm)
+	if s.sched.running() && !s.sched.previewing() {
+		// Apply the new order right away.
+		return s.run(nil)
+	}
+	return nil
+}
+
+func (s *session) fade(args []string) error {
+	if args[0] == "" {
+		fmt.Printf("%gs\n", s.sched.defaultFade())
+		return nil
+	}
+	secs, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || secs < 0 {
+		return userError(fmt.Sprintf("wrong fade duration %q", args[0]))
+	}
+	s.sched.setFade(secs)
+	return nil
+}
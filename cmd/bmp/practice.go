@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matm/bmp/pkg/types"
+)
+
+// practiceSettings tune the looping of a single part.
+type practiceSettings struct {
+	// Seconds to start playing before the part.
+	preroll float64
+	// Pause in seconds between two repetitions.
+	gap float64
+	// Number of one-second beats counted before each repetition.
+	countIn int
+	// Playback speed factor, 1 for the normal speed.
+	tempo float64
+}
+
+var defaultPractice = practiceSettings{tempo: 1}
+
+func (ps practiceSettings) String() string {
+	return fmt.Sprintf("preroll=%g gap=%g countin=%d tempo=%g", ps.preroll, ps.gap, ps.countIn, ps.tempo)
+}
+
+// parsePracticeSettings updates ps with key=value settings such as
+// "preroll=2 gap=1.5 countin=4 tempo=0.8".
+func parsePracticeSettings(ps practiceSettings, s string) (practiceSettings, error) {
+	for _, field := range strings.Fields(s) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return ps, fmt.Errorf("expecting key=value, got %q", field)
+		}
+		switch kv[0] {
+		case "preroll", "gap":
+			f, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil || f < 0 {
+				return ps, fmt.Errorf("wrong duration %q", field)
+			}
+			if kv[0] == "preroll" {
+				ps.preroll = f
+			} else {
+				ps.gap = f
+			}
+		case "countin":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 0 {
+				return ps, fmt.Errorf("wrong count-in %q", field)
+			}
+			ps.countIn = n
+		case "tempo":
+			f, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil || f < minTempo || f > maxTempo {
+				return ps, fmt.Errorf("wrong tempo %q, expecting %g to %g", field, minTempo, maxTempo)
+			}
+			ps.tempo = f
+		default:
+			return ps, fmt.Errorf("unknown practice setting %q", kv[0])
+		}
+	}
+	return ps, nil
+}
+
+// loopState tracks the repetitions of a looped part.
+type loopState struct {
+	// Number of repetitions, 0 for an endless loop.
+	reps int
+	done int
+	// File the part was rendered to at another tempo, empty if none.
+	// Removed once the loop ends.
+	rendered string
+}
+
+func (s *scheduler) setPractice(ps practiceSettings) {
+	s.Lock()
+	defer s.Unlock()
+	s.practice = ps
+}
+
+func (s *scheduler) practiceSettings() practiceSettings {
+	s.Lock()
+	defer s.Unlock()
+	return s.practice
+}
+
+// startLoop plays part p reps times, or endlessly if reps is 0, using the
+// current practice settings. rendered is the file p was rendered to, if any.
+func (s *scheduler) startLoop(p part, reps int, rendered string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.loop != nil && s.loop.rendered == rendered {
+		// Looped again, still needed.
+		s.loop.rendered = ""
+	}
+	s.endLoop()
+	p.start -= s.practice.preroll
+	if p.start < 0 {
+		p.start = 0
+	}
+	s.plan = []part{p}
+	s.pos = 0
+	s.oneShot = false
+	s.started = false
+	s.active = true
+	s.cleanQueue()
+	s.loop = &loopState{reps: reps, rendered: rendered}
+	s.hold = time.Time{}
+	if s.practice.countIn > 0 {
+		s.pauseFor(time.Duration(s.practice.countIn) * time.Second)
+	}
+}
+
+// pauseFor pauses the player for d. Must be called with the lock held.
+func (s *scheduler) pauseFor(d time.Duration) {
+	if err := s.mp.Pause(true); err != nil {
+		logError(err)
+	}
+	s.hold = time.Now().Add(d)
+	s.beat = 0
+}
+
+// nextRepetition is called at the end of the looped part. Must be called with
+// the lock held.
+func (s *scheduler) nextRepetition() {
+	s.loop.done++
+	if s.loop.reps > 0 && s.loop.done >= s.loop.reps {
+		fmt.Printf("practice: done, %d repetitions\n", s.loop.done)
+		s.active = false
+		s.restoreVolume()
+		if s.queue != nil {
+			s.restoreQueue()
+		} else if err := s.mp.Pause(true); err != nil {
+			logError(err)
+		}
+		s.endLoop()
+		return
+	}
+	hold := s.practice.gap + float64(s.practice.countIn)
+	if hold > 0 {
+		s.pauseFor(time.Duration(hold * float64(time.Second)))
+	}
+}
+
+// holdOn waits for the end of the pause between two repetitions, printing the
+// count-in beats, then resumes playback at the start of part p. file is the
+// song currently loaded in MPD. Must be called with the lock held.
+func (s *scheduler) holdOn(p part, file string) error {
+	left := time.Until(s.hold)
+	if left > 0 {
+		beat := int(left.Seconds()) + 1
+		if beat <= s.practice.countIn && beat != s.beat {
+			s.beat = beat
+			fmt.Printf("%d..\n", beat)
+		}
+		return nil
+	}
+	s.hold = time.Time{}
+	if file != p.song {
+		// Seeking happens on next tick, once the song is loaded.
+		s.started = false
+		return s.playSong(p.song)
+	}
+	s.started = true
+	if err := s.mp.SeekTo(p.start); err != nil {
+		return err
+	}
+	return s.mp.Pause(false)
+}
+
+// endLoop forgets the looped part, removing the file it was rendered to if
+// any. Must be called with the lock held.
+func (s *scheduler) endLoop() {
+	if s.loop != nil && s.loop.rendered != "" {
+		if err := removeRendered(s.mp, s.loop.rendered); err != nil {
+			logError(err)
+		}
+	}
+	s.loop = nil
+}
+
+func (s *session) loop(args []string) error {
+	song, err := s.pmp.CurrentSong()
+	if err != nil {
+		return err
+	}
+	idx, _ := strconv.Atoi(args[0])
+	reps := 0
+	if args[1] != "" {
+		reps, _ = strconv.Atoi(args[1])
+	}
+	idx--
+	s.mu.Lock()
+	parts := collectParts(types.BookmarkSet{song.File: s.bms[song.File]}, nil)
+	s.mu.Unlock()
+	if idx > len(parts)-1 || idx < 0 {
+		return errOutOfRange
+	}
+	lp := parts[idx]
+	rendered := ""
+	ps := s.sched.practiceSettings()
+	if ps.tempo != 1 {
+		// MPD can't change the tempo, render the part at the new tempo.
+		if lp, rendered, err = renderPart(s.mp, s.musicDir, lp, ps.preroll, ps.tempo); err != nil {
+			return err
+		}
+	}
+	s.sched.startLoop(lp, reps, rendered)
+	return nil
+}
+
+func (s *session) practice(args []string) error {
+	ps, err := parsePracticeSettings(s.sched.practiceSettings(), args[0])
+	if err != nil {
+		return userError(err.Error())
+	}
+	s.sched.setPractice(ps)
+	fmt.Println(ps)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parsePracticeSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	init := practiceSettings{preroll: 1, gap: 2, countIn: 3}
+	tests := []struct {
+		name    string
+		arg     string
+		want    practiceSettings
+		wantErr bool
+	}{
+		{"no change", "", init, false},
+		{"all", "preroll=2.5 gap=0 countin=4", practiceSettings{preroll: 2.5, gap: 0, countIn: 4}, false},
+		{"one", "countin=0", practiceSettings{preroll: 1, gap: 2, countIn: 0}, false},
+		{"unknown key", "speed=2", init, true},
+		{"negative", "gap=-1", init, true},
+		{"tempo", "tempo=0.75", practiceSettings{preroll: 1, gap: 2, countIn: 3, tempo: 0.75}, false},
+		{"tempo too slow", "tempo=0.1", init, true},
+		{"not key=value", "preroll", init, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePracticeSettings(init, tt.arg)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func Test_scheduler_removeRendered(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		`update "bmp-practice"`: "updating_db: 1\n",
+	})
+	rendered := filepath.Join(t.TempDir(), "part.flac")
+	if err := os.WriteFile(rendered, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := part{song: "bmp-practice/part.flac", start: 0, end: 10}
+	s.sched.startLoop(p, 0, rendered)
+	// Looped again.
+	s.sched.startLoop(p, 0, rendered)
+	assert.FileExists(rendered)
+
+	s.sched.stop()
+	assert.NoFileExists(rendered)
+	assert.Equal([]string{`update "bmp-practice"`}, f.received())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/matm/bmp/pkg/mpd"
+)
+
+// useProfile lists the profiles, or switches to another MPD server.
+func (s *session) useProfile(args []string) error {
+	name := args[0]
+	if name == "" {
+		for _, n := range s.settings.ProfileNames() {
+			cur := " "
+			if n == s.profile {
+				cur = "*"
+			}
+			fmt.Printf("%s %s\t%s\n", cur, n, s.settings.Profiles[n].Address())
+		}
+		return nil
+	}
+	if s.modified && s.songs() > 0 {
+		return errUnsavedOpen
+	}
+	np, err := s.settings.FindProfile(name)
+	if err != nil {
+		return err
+	}
+	// Stay on the current server if the new one doesn't reply.
+	probe := mpd.NewClient(np.Address(), np.Port)
+	probe.SetPassword(np.Password)
+	err = probe.Ping()
+	probe.Close()
+	if err != nil {
+		return userError(fmt.Sprintf("MPD of profile %q unreachable, profile unchanged: %v", name, err))
+	}
+	s.sched.stop()
+	s.mp.SetServer(np.Address(), np.Port, np.Password)
+	if s.pmp != s.mp {
+		s.pmp.SetServer(np.Address(), np.Port, np.Password)
+		if err := usePartition(s.pmp, s.partition, s.output); err != nil {
+			logError(err)
+		}
+	}
+	s.profile, s.prof = name, np
+	if np.MusicDir != "" {
+		s.musicDir = np.MusicDir
+	}
+	fmt.Printf("Using profile %q, MPD at %s\n", name, np.Address())
+	if np.Bookmarks != "" {
+		return s.load(np.Bookmarks)
+	}
+	return nil
+}
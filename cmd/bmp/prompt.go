@@ -3,12 +3,28 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/c-bata/go-prompt"
 	"github.com/matm/bmp/pkg/types"
 )
 
-func completer(d prompt.Document) []prompt.Suggest {
-	return nil
+// completer suggests the commands, with their help, matching the first word
+// being typed.
+func completer(help []commandHelp) prompt.Completer {
+	suggests := make([]prompt.Suggest, 0, len(help))
+	for _, h := range help {
+		for _, key := range h.keys {
+			suggests = append(suggests, prompt.Suggest{Text: key, Description: h.help})
+		}
+	}
+	return func(d prompt.Document) []prompt.Suggest {
+		before := d.TextBeforeCursor()
+		if before == "" || strings.Contains(before, " ") {
+			return nil
+		}
+		return prompt.FilterHasPrefix(suggests, before, false)
+	}
 }
 
 func executor(cmd string) {
@@ -23,7 +39,7 @@ func (p *advancedPrompt) Input() string {
 	return p.pr.Input()
 }
 
-func newPrompt() types.Prompter {
-	p := prompt.New(executor, completer, prompt.OptionHistory([]string{}))
+func newPrompt(help []commandHelp) types.Prompter {
+	p := prompt.New(executor, completer(help), prompt.OptionHistory([]string{}))
 	return &advancedPrompt{pr: p}
 }
@@ -20,7 +20,7 @@ func (p *basicPrompt) Input() string {
 	return string(ch)
 }
 
-func newPrompt() types.Prompter {
+func newPrompt(help []commandHelp) types.Prompter {
 	r := bufio.NewReader(os.Stdin)
 	return &basicPrompt{r: r}
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// backupPlaylist is the stored playlist keeping the user's queue while
+// autoplay runs in a clean queue. Left in place if bmp exits abnormally.
+const backupPlaylist = "bmp-queue-backup"
+
+// queueState is the player state of the user's queue before autoplay.
+type queueState struct {
+	// Position of the current song, if any.
+	pos     int
+	elapsed float64
+	// MPD player state: play, pause or stop.
+	state string
+}
+
+// hasBackup returns true if the user's queue is still saved from a previous
+// run.
+func hasBackup(mp *mpd.Client) (bool, error) {
+	names, err := mp.Playlists()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range names {
+		if name == backupPlaylist {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// saveQueue saves the user's queue to the backup playlist, along with the
+// player state, then clears the queue.
+func saveQueue(mp *mpd.Client) (*queueState, error) {
+	exists, err := hasBackup(mp)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("stored playlist %q left by a previous run, load or remove it first", backupPlaylist)
+	}
+	qs := &queueState{state: "stop"}
+	st, err := mp.Status()
+	if err != nil && err != types.ErrNoSong {
+		return nil, err
+	}
+	if err == nil && st.State != "stop" {
+		cur, err := mp.CurrentSong()
+		if err != nil {
+			return nil, err
+		}
+		qs.pos, qs.elapsed, qs.state = int(cur.Pos), st.Elapsed, st.State
+	}
+	if err := mp.SavePlaylist(backupPlaylist); err != nil {
+		return nil, err
+	}
+	if err := mp.Clear(); err != nil {
+		return nil, err
+	}
+	return qs, nil
+}
+
+// restoreQueue replaces the queue with the user's queue saved by saveQueue,
+// and resumes playback where it was.
+func restoreQueue(mp *mpd.Client, qs *queueState) error {
+	if err := mp.Clear(); err != nil {
+		return err
+	}
+	if err := mp.LoadPlaylist(backupPlaylist); err != nil {
+		return eris.Wrap(err, "restoring queue")
+	}
+	if err := mp.RemovePlaylist(backupPlaylist); err != nil {
+		return err
+	}
+	if qs.state == "stop" {
+		return mp.Stop()
+	}
+	if err := mp.Play(qs.pos); err != nil {
+		return err
+	}
+	if err := mp.SeekTo(qs.elapsed); err != nil {
+		return err
+	}
+	if qs.state == "pause" {
+		return mp.Pause(true)
+	}
+	return nil
+}
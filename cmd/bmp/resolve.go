@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// printMoves lists the songs found at another location of the music library
+// and those not found at all.
+func printMoves(moves []config.Move, missing []string) {
+	for _, m := range moves {
+		fmt.Printf("%s -> %s", m.From, m.To)
+		if m.Others > 0 {
+			fmt.Printf(" (%d other candidates)", m.Others)
+		}
+		fmt.Println()
+	}
+	for _, song := range missing {
+		fmt.Printf("%s: not found in the music library\n", song)
+	}
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func confirm(p types.Prompter, question string) bool {
+	fmt.Printf("%s [y/N]\n", question)
+	answer := strings.ToLower(strings.TrimSpace(p.Input()))
+	return answer == "y" || answer == "yes"
+}
+
+// resolve looks up songs moved in the music library, using their recorded
+// tags, and offers to rewrite their paths.
+func (s *session) resolve() error {
+	// No lock held while querying MPD, the full-screen UI would freeze.
+	s.mu.Lock()
+	bs := config.CloneSet(s.bms)
+	s.mu.Unlock()
+	moves, missing, err := config.Resolve(s.mp, bs)
+	if err != nil {
+		return eris.Wrap(err, "resolving songs")
+	}
+	printMoves(moves, missing)
+	if len(moves) == 0 || !confirm(s.p, "Rewrite paths?") {
+		return nil
+	}
+	s.mu.Lock()
+	s.order = config.ApplyMoves(s.bms, s.order, moves)
+	for _, m := range moves {
+		if m.From == s.selected {
+			s.selected = m.To
+		}
+	}
+	s.checkSelected()
+	printChanges(config.NormalizeBookmarkSet(s.bms))
+	s.mu.Unlock()
+	// Mark buffer as modified.
+	s.modified = true
+	return nil
+}
+
+func (s *session) resolveSongs(args []string) error {
+	return s.resolve()
+}
@@ -2,74 +2,528 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/matm/bmp/pkg/config"
 	"github.com/matm/bmp/pkg/mpd"
 	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
 )
 
-var autoplay = false
+const (
+	schedSleep = 500 * time.Millisecond
+	// Shorter sleep while fading for smoother volume ramps.
+	fadeSleep = 100 * time.Millisecond
+)
 
-const schedSleep = 500 * time.Millisecond
+// playMode is the order in which the best parts are played during autoplay.
+type playMode string
 
-func schedule(mp *mpd.Client, bms *types.BookmarkSet) {
-	for {
-		time.Sleep(schedSleep)
-		if !autoplay {
-			continue
-		}
-		// Get current song.
-		// Current song info.
-		s, err := mp.CurrentSong()
-		if err != nil {
-			// FIXME: Log error.
-			time.Sleep(time.Second)
-			continue
-		}
-		st, err := mp.Status()
-		if err != nil {
-			time.Sleep(time.Second)
-			continue
-		}
-		mu.Lock()
-		bookmarks, ok := (*bms)[s.File]
-		mu.Unlock()
-		if !ok {
-			continue
+const (
+	// Songs and parts in file order.
+	modeFile playMode = "file"
+	// Songs shuffled, parts of a song in order.
+	modeShuffle playMode = "shuffle"
+	// All parts shuffled across songs.
+	modeParts playMode = "parts"
+	// Endless random parts, the higher the rating the more often.
+	modeWeighted playMode = "weighted"
+	// Endless loop of a single part.
+	modeRepeatOne playMode = "repeat-one"
+	// Endless loop of all parts in file order.
+	modeRepeatAll playMode = "repeat-all"
+)
+
+var playModes = []playMode{modeFile, modeShuffle, modeParts, modeWeighted, modeRepeatOne, modeRepeatAll}
+
+func parsePlayMode(s string) (playMode, error) {
+	for _, m := range playModes {
+		if string(m) == s {
+			return m, nil
 		}
-		// This song has bookmarks.
-		for j, bk := range bookmarks {
-			start, err := humanToSeconds(bk.Start)
+	}
+	names := make([]string, 0, len(playModes))
+	for _, m := range playModes {
+		names = append(names, string(m))
+	}
+	return "", fmt.Errorf("unknown play mode %q, expecting one of %s", s, strings.Join(names, ", "))
+}
+
+// part is a bookmarked time range of a song, ready to be played.
+type part struct {
+	song            string
+	start, end      float64
+	rating          int
+	fadeIn, fadeOut float64
+}
+
+// weight of a part for the weighted play mode. Unrated parts count as rated 1.
+func (p part) weight() int {
+	if p.rating > 0 {
+		return p.rating
+	}
+	return 1
+}
+
+// collectParts lists all complete ranges of the bookmark set, in song order.
+// Ranges still being defined or with a bad time format are skipped.
+func collectParts(bms types.BookmarkSet, order []string) []part {
+	parts := make([]part, 0)
+	for _, song := range config.SongOrder(bms, order) {
+		for _, bm := range bms[song] {
+			if bm.End == "" {
+				continue
+			}
+			start, err := config.ParseTime(bm.Start)
+			if err != nil {
+				continue
+			}
+			end, err := config.ParseTime(bm.End)
 			if err != nil {
-				fmt.Printf("error parsing %q", bk.Start)
 				continue
 			}
-			if bk.End == "" {
-				// A bookmark range is being defined.
-				break
+			parts = append(parts, part{
+				song:    song,
+				start:   start,
+				end:     end,
+				rating:  bm.Rating,
+				fadeIn:  bm.FadeIn,
+				fadeOut: bm.FadeOut,
+			})
+		}
+	}
+	return parts
+}
+
+// makePlan orders the parts to play according to mode.
+func makePlan(mode playMode, parts []part, rnd *rand.Rand) []part {
+	plan := make([]part, len(parts))
+	copy(plan, parts)
+	switch mode {
+	case modeShuffle:
+		songs := make([]string, 0)
+		bySong := make(map[string][]part)
+		for _, p := range plan {
+			if _, ok := bySong[p.song]; !ok {
+				songs = append(songs, p.song)
+			}
+			bySong[p.song] = append(bySong[p.song], p)
+		}
+		rnd.Shuffle(len(songs), func(i, j int) { songs[i], songs[j] = songs[j], songs[i] })
+		plan = plan[:0]
+		for _, song := range songs {
+			plan = append(plan, bySong[song]...)
+		}
+	case modeParts:
+		rnd.Shuffle(len(plan), func(i, j int) { plan[i], plan[j] = plan[j], plan[i] })
+	}
+	return plan
+}
+
+// pickWeighted returns the index of a random part, weighted by rating.
+func pickWeighted(parts []part, rnd *rand.Rand) int {
+	total := 0
+	for _, p := range parts {
+		total += p.weight()
+	}
+	n := rnd.Intn(total)
+	for k, p := range parts {
+		n -= p.weight()
+		if n < 0 {
+			return k
+		}
+	}
+	return len(parts) - 1
+}
+
+// fadeVolume returns the volume to apply at elapsed seconds within part p so
+// that it fades in after its start and fades out before its end.
+func fadeVolume(base int, p part, fadeIn, fadeOut, elapsed float64) int {
+	ratio := 1.0
+	if fadeIn > 0 && elapsed < p.start+fadeIn {
+		ratio = (elapsed - p.start) / fadeIn
+	}
+	if fadeOut > 0 && elapsed > p.end-fadeOut {
+		if r := (p.end - elapsed) / fadeOut; r < ratio {
+			ratio = r
+		}
+	}
+	if ratio < 0 {
+		ratio = 0
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	return int(math.Round(float64(base) * ratio))
+}
+
+// scheduler drives MPD playback through a plan of parts.
+type scheduler struct {
+	sync.Mutex
+	mp   *mpd.Client
+	rnd  *rand.Rand
+	mode playMode
+	plan []part
+	// Index of the part being played.
+	pos    int
+	active bool
+	// Play the plan once, in order, and pause at the end of the last part.
+	oneShot bool
+	// True once playback has been moved to the start of the current part.
+	started bool
+	// Queue IDs of songs added to MPD.
+	ids map[string]int64
+	// Default fade-in and fade-out duration in seconds, for parts not
+	// having their own.
+	fade float64
+	// User's volume, restored when autoplay stops, and the last volume set
+	// while fading. Only relevant if volKnown is true.
+	base, vol int
+	volKnown  bool
+	fading    bool
+	// Practice settings and state of the part being looped, if any.
+	practice practiceSettings
+	loop     *loopState
+	// Playback is held paused until then, between two repetitions.
+	hold time.Time
+	// Last count-in beat printed.
+	beat int
+	// Play in an empty queue, the user's queue being saved in queue and
+	// restored once autoplay stops.
+	clean bool
+	queue *queueState
+}
+
+func newScheduler(mp *mpd.Client, mode playMode, fade float64, clean bool) *scheduler {
+	return &scheduler{
+		mp:       mp,
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		mode:     mode,
+		ids:      make(map[string]int64),
+		fade:     fade,
+		practice: defaultPractice,
+		clean:    clean,
+	}
+}
+
+// cleanQueue saves and clears the user's queue if playing in a clean queue.
+// Must be called with the lock held.
+func (s *scheduler) cleanQueue() {
+	if !s.clean || s.queue != nil {
+		return
+	}
+	qs, err := saveQueue(s.mp)
+	if err != nil {
+		logError(eris.Wrap(err, "clean queue, playing in the current queue"))
+		return
+	}
+	s.queue = qs
+	s.ids = make(map[string]int64)
+}
+
+// restoreQueue gives the user back their queue if cleaned. Must be called
+// with the lock held.
+func (s *scheduler) restoreQueue() {
+	if s.queue == nil {
+		return
+	}
+	if err := restoreQueue(s.mp, s.queue); err != nil {
+		logError(err)
+	}
+	s.queue = nil
+	s.ids = make(map[string]int64)
+}
+
+// start plays parts in the order of the current play mode. If current is a song
+// having parts, playback starts with it. Returns the number of parts planned.
+func (s *scheduler) start(parts []part, current string) int {
+	s.Lock()
+	defer s.Unlock()
+	s.plan = makePlan(s.mode, parts, s.rnd)
+	s.pos = 0
+	s.oneShot = false
+	s.started = false
+	s.endLoop()
+	s.hold = time.Time{}
+	s.active = len(s.plan) > 0
+	if !s.active {
+		return 0
+	}
+	s.cleanQueue()
+	if s.mode == modeWeighted {
+		s.pos = pickWeighted(s.plan, s.rnd)
+	}
+	for k, p := range s.plan {
+		if p.song == current {
+			s.pos = k
+			break
+		}
+	}
+	return len(s.plan)
+}
+
+// preview plays parts once, in the given order whatever the play mode, then
+// pauses playback at the end of the last one. A clean queue is kept while
+// previewing, and restored at the end. Returns the number of parts planned.
+func (s *scheduler) preview(parts []part) int {
+	s.Lock()
+	defer s.Unlock()
+	s.plan = parts
+	s.pos = 0
+	s.oneShot = true
+	s.started = false
+	s.endLoop()
+	s.hold = time.Time{}
+	s.active = len(s.plan) > 0
+	return len(s.plan)
+}
+
+func (s *scheduler) stop() {
+	s.Lock()
+	defer s.Unlock()
+	s.active = false
+	s.restoreVolume()
+	s.restoreQueue()
+	s.endLoop()
+}
+
+// restoreVolume sets back the user's volume if changed by a fade. Must be
+// called with the lock held.
+func (s *scheduler) restoreVolume() {
+	s.fading = false
+	if !s.volKnown {
+		return
+	}
+	s.volKnown = false
+	if s.vol != s.base {
+		if err := s.mp.SetVolume(s.base); err != nil {
+			logError(err)
+		}
+	}
+}
+
+func (s *scheduler) setFade(secs float64) {
+	s.Lock()
+	defer s.Unlock()
+	s.fade = secs
+}
+
+func (s *scheduler) defaultFade() float64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.fade
+}
+
+// fades returns the fade-in and fade-out durations of a part, zero if turned
+// off.
+func (s *scheduler) fades(p part) (float64, float64) {
+	return s.fadeOf(p.fadeIn), s.fadeOf(p.fadeOut)
+}
+
+// fadeOf returns the duration of a fade of a part, the default one if unset.
+func (s *scheduler) fadeOf(secs float64) float64 {
+	switch {
+	case secs == 0:
+		return s.fade
+	case secs < 0:
+		// types.NoFade.
+		return 0
+	}
+	return secs
+}
+
+// setVolume applies vol if different from the last volume set. Must be called
+// with the lock held.
+func (s *scheduler) setVolume(vol int) error {
+	if !s.volKnown || vol == s.vol {
+		return nil
+	}
+	s.vol = vol
+	return s.mp.SetVolume(vol)
+}
+
+func (s *scheduler) running() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.active
+}
+
+// previewing returns true while a preview plan plays.
+func (s *scheduler) previewing() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.active && s.oneShot
+}
+
+func (s *scheduler) setMode(mode playMode) {
+	s.Lock()
+	defer s.Unlock()
+	s.mode = mode
+}
+
+func (s *scheduler) currentMode() playMode {
+	s.Lock()
+	defer s.Unlock()
+	return s.mode
+}
+
+// advance moves to the next part of the plan. Must be called with the lock
+// held.
+func (s *scheduler) advance() {
+	s.started = false
+	if s.loop != nil {
+		s.nextRepetition()
+		return
+	}
+	if s.oneShot {
+		s.pos++
+		if s.pos >= len(s.plan) {
+			s.active = false
+			s.restoreVolume()
+			if s.queue != nil {
+				s.restoreQueue()
+				return
+			}
+			if err := s.mp.Pause(true); err != nil {
+				logError(err)
+			}
+		}
+		return
+	}
+	switch s.mode {
+	case modeRepeatOne:
+	case modeWeighted:
+		s.pos = pickWeighted(s.plan, s.rnd)
+	case modeRepeatAll:
+		s.pos = (s.pos + 1) % len(s.plan)
+	default:
+		s.pos++
+		if s.pos >= len(s.plan) {
+			s.active = false
+			s.restoreVolume()
+			s.restoreQueue()
+			fmt.Println("autoplay: end of parts")
+		}
+	}
+}
+
+// playSong starts playing song from the MPD queue, adding it first if needed.
+func (s *scheduler) playSong(song string) error {
+	if id, ok := s.ids[song]; ok {
+		if err := s.mp.PlaySongID(id); err == nil {
+			return nil
+		}
+		// Probably removed from the queue, add it again.
+		delete(s.ids, song)
+	}
+	id, err := s.mp.AddToQueue(song)
+	if err != nil {
+		return err
+	}
+	s.ids[song] = id
+	return s.mp.PlaySongID(id)
+}
+
+// tick checks the player state and moves playback to the current part of the
+// plan if needed.
+func (s *scheduler) tick() error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.active {
+		return nil
+	}
+	p := s.plan[s.pos]
+	st, err := s.mp.Status()
+	if err != nil && err != types.ErrNoSong {
+		return err
+	}
+	if !s.hold.IsZero() {
+		var file string
+		if err == nil {
+			if cur, err := s.mp.CurrentSong(); err == nil {
+				file = cur.File
+			}
+		}
+		return s.holdOn(p, file)
+	}
+	if st != nil && st.State == "pause" {
+		return nil
+	}
+	if st != nil && st.Volume >= 0 {
+		// A volume of -1 means MPD has no mixer, fading is not possible.
+		if !s.volKnown {
+			s.base, s.vol, s.volKnown = int(st.Volume), int(st.Volume), true
+		} else if !s.fading && int(st.Volume) != s.vol {
+			// Changed by the user.
+			s.base, s.vol = int(st.Volume), int(st.Volume)
+		}
+	}
+	fadeIn, fadeOut := s.fades(p)
+	var file string
+	if err == nil {
+		cur, err := s.mp.CurrentSong()
+		if err != nil && err != types.ErrNoSong {
+			return err
+		}
+		if cur != nil {
+			file = cur.File
+		}
+	}
+	if file != p.song {
+		if s.started {
+			// The part lasted until the end of the song.
+			s.advance()
+			return nil
+		}
+		if fadeIn > 0 {
+			if err := s.setVolume(0); err != nil {
+				return err
 			}
-			if int(st.Elapsed) < start {
-				canSeek := false
-				if j == 0 {
-					canSeek = true
-				} else {
-					end, err := humanToSeconds(bookmarks[j-1].End)
-					if err != nil {
-						fmt.Printf("error parsing %q", bk.End)
-						continue
-					}
-					if int(st.Elapsed) > end {
-						canSeek = true
-					}
-				}
-				if canSeek {
-					err = mp.SeekTo(start)
-					if err != nil {
-						fmt.Printf("could not seek to %s", bk.Start)
-						continue
-					}
-				}
+		}
+		if err := s.playSong(p.song); err != nil {
+			// Can't play this one, skip it.
+			s.advance()
+			return err
+		}
+		return nil
+	}
+	if !s.started {
+		s.started = true
+		if fadeIn > 0 {
+			if err := s.setVolume(0); err != nil {
+				return err
 			}
 		}
+		return s.mp.SeekTo(p.start)
+	}
+	if st.Elapsed >= p.end {
+		s.advance()
+		return nil
+	}
+	vol := fadeVolume(s.base, p, fadeIn, fadeOut, st.Elapsed)
+	s.fading = vol != s.base
+	return s.setVolume(vol)
+}
+
+func (s *scheduler) sleep() time.Duration {
+	s.Lock()
+	defer s.Unlock()
+	if s.fading {
+		return fadeSleep
+	}
+	return schedSleep
+}
+
+func (s *scheduler) run() {
+	for {
+		time.Sleep(s.sleep())
+		if err := s.tick(); err != nil {
+			logError(err)
+			time.Sleep(time.Second)
+		}
 	}
 }
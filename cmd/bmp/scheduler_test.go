@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_collectParts(t *testing.T) {
+	assert := assert.New(t)
+
+	bms := types.BookmarkSet{
+		"c.mp3": {{Start: "00:10.5", End: "00:20.4"}},
+		"a.mp3": {{Start: "01:00", End: "01:10"}, {Start: "02:00"}},
+		"b.mp3": {{Start: "00:05", End: "00:15", Rating: 3}},
+	}
+	parts := collectParts(bms, []string{"b.mp3", "gone.mp3"})
+	assert.Equal([]part{
+		{song: "b.mp3", start: 5, end: 15, rating: 3},
+		{song: "a.mp3", start: 60, end: 70},
+		{song: "c.mp3", start: 10.5, end: 20.4},
+	}, parts)
+}
+
+func Test_makePlan(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := []part{
+		{song: "a.mp3", start: 0, end: 10},
+		{song: "a.mp3", start: 20, end: 30},
+		{song: "b.mp3", start: 0, end: 10},
+		{song: "c.mp3", start: 0, end: 10},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for _, mode := range playModes {
+		plan := makePlan(mode, parts, rnd)
+		assert.ElementsMatch(parts, plan, mode)
+		switch mode {
+		case modeFile, modeWeighted, modeRepeatOne, modeRepeatAll:
+			assert.Equal(parts, plan, mode)
+		case modeShuffle:
+			// Parts of a song are kept together and in order.
+			for k, p := range plan {
+				if p.song == "a.mp3" && p.start == 0 {
+					assert.Equal(parts[1], plan[k+1])
+				}
+			}
+		}
+	}
+}
+
+func Test_pickWeighted(t *testing.T) {
+	assert := assert.New(t)
+
+	parts := []part{
+		{song: "a.mp3", rating: 5},
+		{song: "b.mp3"},
+	}
+	rnd := rand.New(rand.NewSource(1))
+	hits := make([]int, len(parts))
+	for k := 0; k < 600; k++ {
+		hits[pickWeighted(parts, rnd)]++
+	}
+	assert.Greater(hits[0], 3*hits[1])
+	assert.NotZero(hits[1])
+}
+
+func Test_parsePlayMode(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := parsePlayMode("repeat-one")
+	assert.NoError(err)
+	assert.Equal(modeRepeatOne, m)
+	_, err = parsePlayMode("random")
+	assert.Error(err)
+}
+
+func Test_fadeVolume(t *testing.T) {
+	p := part{start: 10, end: 20}
+	tests := []struct {
+		name            string
+		fadeIn, fadeOut float64
+		elapsed         float64
+		want            int
+	}{
+		{"no fade", 0, 0, 10, 80},
+		{"fade-in start", 2, 0, 10, 0},
+		{"fade-in middle", 2, 0, 11, 40},
+		{"fade-in done", 2, 0, 12, 80},
+		{"fade-out middle", 0, 4, 18, 40},
+		{"fade-out end", 0, 4, 20, 0},
+		{"overlapping fades", 8, 8, 15, 50},
+		{"before start", 2, 0, 5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fadeVolume(80, p, tt.fadeIn, tt.fadeOut, tt.elapsed); got != tt.want {
+				t.Errorf("fadeVolume() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scheduler_fades(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newScheduler(nil, modeFile, 3, false)
+	in, out := s.fades(part{fadeOut: 1.5})
+	assert.Equal(3.0, in, "default")
+	assert.Equal(1.5, out)
+	in, out = s.fades(part{fadeIn: types.NoFade})
+	assert.Equal(0.0, in, "turned off")
+	assert.Equal(3.0, out)
+}
+
+func Test_scheduler_tickTenths(t *testing.T) {
+	assert := assert.New(t)
+
+	s, f := newFakeSession(t, map[string]string{
+		"currentsong":  playingSong,
+		"status":       "state: play\nelapsed: 20.3\nduration: 200.0\nvolume: -1\n",
+		"seekcur 10.5": "",
+	})
+	s.sched.start([]part{{song: "a.mp3", start: 10.5, end: 20.4}}, "a.mp3")
+
+	assert.NoError(s.sched.tick())
+	assert.Contains(f.received(), "seekcur 10.5")
+	// Not past the end yet, the tenth of a second matters.
+	assert.NoError(s.sched.tick())
+	assert.True(s.sched.running())
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// session is the state shared by the shell commands.
+type session struct {
+	// Guards bms and order, read by the full-screen UI while commands run.
+	mu sync.Mutex
+	// Keep track of bookmarks per song. The key is the song's filename.
+	bms types.BookmarkSet
+	// Songs in the order they were loaded or bookmarked.
+	order []string
+	// Bracket open, i.e [ for marking the beginning of a range.
+	bOpen bool
+	// Checked before exiting.
+	modified bool
+	// Name of the loaded collection, saved with the W command.
+	collection string
+	// Collection as last loaded or saved, the common version when merging
+	// changes made in storage by someone else.
+	base types.BookmarkSet
+	// Receives a value once the collection changes in storage.
+	changed chan struct{}
+	// Songs of the last library listing, by position.
+	results []string
+	// Song whose bookmarks are edited instead of the current song's, if set.
+	selected string
+	// Bookmarks before each edit made in the user's editor, the last one
+	// first restored.
+	undo []snapshot
+	// Set once the program must exit.
+	done bool
+	// Set while MPD is unreachable, see startOffline. reachable is closed
+	// once MPD replies again.
+	offline   bool
+	reachable chan struct{}
+	// Look up moved songs when loading bookmarks, see the -no-resolve flag,
+	// or once online if loaded offline.
+	autoResolve    bool
+	resolvePending bool
+
+	mp *mpd.Client
+	// MPD client driving autoplay, in its own partition if requested.
+	pmp   *mpd.Client
+	sched *scheduler
+	st    config.Store
+	// Kind of the storage, see openStore.
+	storeKind string
+	// Stops watching the loaded collection.
+	unwatch func()
+
+	settings *config.Settings
+	// Name of the profile in use, and its settings.
+	profile string
+	prof    config.Profile
+	// Partition and output given with -partition and -output.
+	partition, output string
+	musicDir          string
+
+	reg *registry
+	km  *keymap
+	// Asks questions to the user, swapped while the full-screen UI runs.
+	p types.Prompter
+}
+
+// exec runs a shell command line, reporting errors to the user. Lines are
+// expanded with the user's aliases and key bindings first.
+func (s *session) exec(line string) {
+	s.checkOnline()
+	s.checkChanged()
+	line = s.km.expand(line)
+	if line == "" {
+		return
+	}
+	cmd, args := s.reg.find(line)
+	if cmd == nil {
+		fmt.Println("Unknown command")
+		return
+	}
+	if s.offline && !cmd.offline {
+		fmt.Println(errOffline)
+		return
+	}
+	err := cmd.run(s, args)
+	var ue userError
+	switch {
+	case err == nil, errors.Is(err, types.ErrNoSong):
+	case errors.As(err, &ue):
+		fmt.Println(ue)
+	default:
+		logError(err)
+	}
+}
+
+// songs returns the number of songs having bookmarks.
+func (s *session) songs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bms)
+}
+
+// bookmarks returns a copy of the bookmarks of a song.
+func (s *session) bookmarks(song string) []types.Bookmark {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.Bookmark(nil), s.bms[song]...)
+}
+
+// editedSong returns the song whose bookmarks are edited: the selected song
+// if any, which works without MPD playing, the current song otherwise.
+func (s *session) editedSong() (*types.Song, error) {
+	if s.selected == "" {
+		if s.offline {
+			return nil, userError("MPD is unreachable, select a song with 'sel' first")
+		}
+		return s.pmp.CurrentSong()
+	}
+	song := &types.Song{File: s.selected}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bm := range s.bms[s.selected] {
+		if bm.Tags.Duration > 0 {
+			song.Duration = float64(bm.Tags.Duration)
+			break
+		}
+	}
+	return song, nil
+}
+
+// checkSelected goes back to editing the current song once the selected song
+// is no longer in the set. Must be called with the lock held.
+func (s *session) checkSelected() {
+	if _, ok := s.bms[s.selected]; s.selected == "" || ok {
+		return
+	}
+	fmt.Printf("%s no longer bookmarked, editing the current song\n", s.selected)
+	s.selected = ""
+}
+
+// bookmarkAt returns the edited song and the index of its bookmark at
+// position pos, starting at 1.
+func (s *session) bookmarkAt(pos string) (*types.Song, int, error) {
+	song, err := s.editedSong()
+	if err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	n, ok := len(s.bms[song.File]), s.bms[song.File] != nil
+	s.mu.Unlock()
+	if !ok {
+		return nil, 0, errNoBookmark
+	}
+	if pos == "" {
+		return nil, 0, errMissingPos
+	}
+	idx, err := strconv.Atoi(pos)
+	if err != nil {
+		return nil, 0, eris.Wrap(err, "position")
+	}
+	if idx < 1 || idx > n {
+		return nil, 0, errOutOfRange
+	}
+	return song, idx - 1, nil
+}
+
+// load loads a collection in place of the current bookmarks.
+func (s *session) load(name string) error {
+	bs, o, err := s.st.Load(name)
+	if err != nil {
+		return err
+	}
+	if s.storeKind != storeFile {
+		fmt.Printf("Loaded %d songs from collection %q\n", len(bs), name)
+	}
+	s.mu.Lock()
+	s.bms, s.order = bs, o
+	s.selected, s.undo = "", nil
+	s.modified = printChanges(config.NormalizeBookmarkSet(s.bms))
+	s.base = config.CloneSet(s.bms)
+	s.mu.Unlock()
+	s.collection = name
+	s.unwatch()
+	s.changed = make(chan struct{}, 1)
+	s.unwatch, err = s.st.Watch(name, func() {
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+		fmt.Printf("\nCollection %q changed in storage, reloading it with the next command\n", name)
+	})
+	if err != nil {
+		s.unwatch = func() {}
+		return err
+	}
+	s.resolveLoaded()
+	return nil
+}
+
+// resolveLoaded looks up the moved songs of the bookmarks just loaded, unless
+// disabled with the -no-resolve flag. Offline, it's done once MPD is back.
+func (s *session) resolveLoaded() {
+	if !s.autoResolve || s.songs() == 0 {
+		return
+	}
+	if s.offline {
+		s.resolvePending = true
+		return
+	}
+	if err := s.resolve(); err != nil {
+		logError(err)
+	}
+}
+
+// save saves bookmarks to the loaded collection.
+func (s *session) save() error {
+	s.mu.Lock()
+	err := s.st.Save(s.collection, s.bms, s.order)
+	if err == nil {
+		s.base = config.CloneSet(s.bms)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return eris.Wrap(err, "save")
+	}
+	s.modified = false
+	return nil
+}
+
+// autosave saves changes right away if the profile asks for it.
+func (s *session) autosave() {
+	if !s.prof.Autosave || !s.modified || s.collection == "" {
+		return
+	}
+	if err := s.save(); err != nil {
+		logError(err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// Storage backends of bookmarks.
+const (
+	storeFile    = "file"
+	storeSticker = "sticker"
+	storeSQLite  = "sqlite"
+)
+
+// openStore returns the bookmarks storage of the given kind. dbPath is only
+// used by the SQLite storage, the default location is used if empty.
+func openStore(kind string, mp *mpd.Client, dbPath string) (config.Store, error) {
+	switch kind {
+	case storeFile:
+		return config.NewFileStore("."), nil
+	case storeSticker:
+		return config.NewStickerStore(mp), nil
+	case storeSQLite:
+		if dbPath == "" {
+			var err error
+			dbPath, err = config.DefaultDatabasePath()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+			return nil, eris.Wrap(err, "database directory")
+		}
+		return config.OpenSQLiteStore(dbPath)
+	}
+	return nil, fmt.Errorf("unknown storage %q, expecting %s, %s or %s", kind, storeFile, storeSticker, storeSQLite)
+}
+
+// printCollections lists the collections of a store. If pattern is not empty,
+// only collections having a song whose name contains pattern are listed, with
+// the matching songs.
+func printCollections(st config.Store, pattern string) error {
+	if pattern == "" {
+		names, err := st.Collections()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	q, ok := st.(config.Querier)
+	if !ok {
+		return eris.New("this storage does not support searching songs")
+	}
+	res, err := q.Query(pattern)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(res))
+	for name := range res {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+		for _, song := range res[name] {
+			fmt.Printf("\t%s\n", song)
+		}
+	}
+	return nil
+}
+
+func (s *session) storeCollection(args []string) error {
+	if s.collection == "" {
+		return userError("no bookmarks file loaded, use 'w file' instead")
+	}
+	return s.save()
+}
+
+func (s *session) collections(args []string) error {
+	return printCollections(s.st, args[0])
+}
+
+func (s *session) open(args []string) error {
+	if s.modified && s.songs() > 0 {
+		return errUnsavedOpen
+	}
+	return s.load(args[0])
+}
+
+func (s *session) history(args []string) error {
+	h, ok := s.st.(config.Historian)
+	if !ok {
+		return userError("this storage does not keep any history")
+	}
+	if args[0] == "" {
+		revs, err := h.History(s.collection)
+		if err != nil {
+			return err
+		}
+		for _, rev := range revs {
+			fmt.Printf("%d\t%s\t%d songs, %d ranges\n", rev.ID, rev.Created.Format("2006-01-02 15:04:05"), rev.Songs, rev.Ranges)
+		}
+		return nil
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return eris.Wrap(err, "revision")
+	}
+	bs, o, err := h.LoadRevision(s.collection, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.bms, s.order = bs, o
+	s.checkSelected()
+	s.mu.Unlock()
+	fmt.Printf("Revision %d loaded, use 'W' to save it as the latest one\n", id)
+	// Mark buffer as modified.
+	s.modified = true
+	s.resolveLoaded()
+	return nil
+}
+
+// checkChanged reloads the collection if changed in storage since loaded or
+// saved.
+func (s *session) checkChanged() {
+	select {
+	case <-s.changed:
+	default:
+		return
+	}
+	if err := s.reload(); err != nil {
+		logError(err)
+	}
+}
+
+// reload reads the collection again. Unsaved changes, including a range
+// being marked, are merged with the ones made in storage, asking which
+// version to keep for songs changed on both sides.
+func (s *session) reload() error {
+	theirs, order, err := s.st.Load(s.collection)
+	if err != nil {
+		return err
+	}
+	printChanges(config.NormalizeBookmarkSet(theirs))
+	if !s.modified && !s.bOpen {
+		s.mu.Lock()
+		s.bms, s.order = theirs, order
+		s.base = config.CloneSet(theirs)
+		s.checkSelected()
+		s.mu.Unlock()
+		fmt.Printf("Collection %q reloaded\n", s.collection)
+		return nil
+	}
+	s.mu.Lock()
+	merged, conflicts := config.Merge(s.base, s.bms, theirs)
+	s.mu.Unlock()
+	for _, song := range conflicts {
+		fmt.Printf("%s changed on both sides\n", song)
+		fmt.Printf("  yours:  %s\n", formatRanges(merged[song]))
+		fmt.Printf("  theirs: %s\n", formatRanges(theirs[song]))
+		if confirm(s.p, "Keep your ranges rather than theirs?") {
+			continue
+		}
+		if bms, ok := theirs[song]; ok {
+			merged[song] = bms
+		} else {
+			delete(merged, song)
+		}
+	}
+	s.mu.Lock()
+	s.bms, s.order = merged, config.MergeOrder(s.order, order)
+	s.base = config.CloneSet(theirs)
+	s.checkSelected()
+	if s.bOpen && !hasOpenRange(s.bms) {
+		s.bOpen = false
+		fmt.Println("Range being marked dropped, their ranges kept")
+	}
+	s.mu.Unlock()
+	fmt.Printf("Collection %q merged with your unsaved changes\n", s.collection)
+	return nil
+}
+
+// hasOpenRange returns true if a song of the set has a range being marked,
+// left without end.
+func hasOpenRange(bs types.BookmarkSet) bool {
+	for _, bms := range bs {
+		if n := len(bms); n > 0 && bms[n-1].End == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRanges returns the ranges of a song on a line.
+func formatRanges(bms []types.Bookmark) string {
+	if len(bms) == 0 {
+		return "none"
+	}
+	rs := make([]string, 0, len(bms))
+	for _, bm := range bms {
+		rs = append(rs, config.FormatRange(bm))
+	}
+	return strings.Join(rs, " ")
+}
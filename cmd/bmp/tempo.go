@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/rotisserie/eris"
+)
+
+// Tempo limits of ffmpeg's atempo filter in a single pass.
+const (
+	minTempo = 0.5
+	maxTempo = 2.0
+)
+
+// renderDir is the directory, relative to the MPD music directory, where
+// parts are rendered at a different tempo.
+const renderDir = "bmp-practice"
+
+// Max time to wait for MPD to index a rendered part.
+const updateTimeout = 30 * time.Second
+
+// renderPart renders part p, starting preroll seconds earlier, at the given
+// tempo with ffmpeg. The pitch is preserved. The rendered file is written to
+// the MPD music directory then indexed so MPD can play it, until removed with
+// removeRendered. Returns the part covering the whole rendered file and the
+// file's path.
+func renderPart(mp *mpd.Client, musicDir string, p part, preroll, tempo float64) (part, string, error) {
+	if musicDir == "" {
+		return part{}, "", eris.New("rendering needs the MPD music directory, see the -music-dir flag")
+	}
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return part{}, "", eris.Wrap(err, "rendering needs ffmpeg")
+	}
+	start := p.start - preroll
+	if start < 0 {
+		start = 0
+	}
+	key := fmt.Sprintf("%s|%g|%g|%g", p.song, start, p.end, tempo)
+	name := fmt.Sprintf("%x.flac", sha1.Sum([]byte(key)))
+	uri := renderDir + "/" + name
+	dst := filepath.Join(musicDir, renderDir, name)
+	if _, err := os.Stat(dst); err != nil {
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return part{}, "", eris.Wrap(err, "render")
+		}
+		fmt.Println("Rendering...")
+		cmd := exec.Command(ffmpeg, "-v", "error", "-y",
+			"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+			"-to", strconv.FormatFloat(p.end, 'f', 3, 64),
+			"-i", filepath.Join(musicDir, p.song),
+			"-vn", "-filter:a", fmt.Sprintf("atempo=%g", tempo),
+			dst)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.Remove(dst)
+			return part{}, "", eris.Wrapf(err, "ffmpeg: %s", out)
+		}
+		if err := mp.Update(renderDir); err != nil {
+			return part{}, "", err
+		}
+		// Wait for MPD to index the new file.
+		deadline := time.Now().Add(updateTimeout)
+		for {
+			time.Sleep(200 * time.Millisecond)
+			updating, err := mp.Updating()
+			if err != nil {
+				return part{}, "", err
+			}
+			if !updating {
+				break
+			}
+			if time.Now().After(deadline) {
+				return part{}, "", eris.New("timeout waiting for MPD database update")
+			}
+		}
+	}
+	dur := (p.end - start) / tempo
+	return part{song: uri, start: 0, end: dur}, dst, nil
+}
+
+// removeRendered removes a file written by renderPart from the music
+// directory and from the MPD database.
+func removeRendered(mp *mpd.Client, file string) error {
+	if err := os.Remove(file); err != nil {
+		return eris.Wrap(err, "remove rendered part")
+	}
+	return mp.Update(renderDir)
+}
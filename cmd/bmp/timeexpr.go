@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// timeExpr is a time given to a command: either a position in the song, e.g.
+// 02:15, 1:02.5 or 75, or an offset from a reference position when signed,
+// e.g. +0.5 or -1:00.
+type timeExpr struct {
+	secs     float64
+	relative bool
+}
+
+// parseTimeExpr parses a time expression: an optional sign followed by
+// seconds, M:SS or H:MM:SS, seconds having an optional fractional part.
+func parseTimeExpr(s string) (timeExpr, error) {
+	var te timeExpr
+	sign := 1.0
+	switch {
+	case strings.HasPrefix(s, "+"):
+		te.relative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "-"):
+		te.relative, sign = true, -1
+		s = s[1:]
+	}
+	fields := strings.Split(s, ":")
+	if s == "" || len(fields) > 3 {
+		return timeExpr{}, fmt.Errorf("bad time %q", s)
+	}
+	for k, f := range fields {
+		last := k == len(fields)-1
+		if f == "" || strings.Trim(f, "0123456789.") != "" || (!last && strings.Contains(f, ".")) {
+			return timeExpr{}, fmt.Errorf("bad time %q", s)
+		}
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return timeExpr{}, fmt.Errorf("bad time %q", s)
+		}
+		if k > 0 && v >= 60 {
+			return timeExpr{}, fmt.Errorf("bad time %q: minutes and seconds must be less than 60", s)
+		}
+		te.secs = te.secs*60 + v
+	}
+	te.secs *= sign
+	return te, nil
+}
+
+// at returns the position in seconds the expression stands for, relative
+// offsets being added to ref. Never negative.
+func (te timeExpr) at(ref float64) float64 {
+	pos := te.secs
+	if te.relative {
+		pos += ref
+	}
+	return math.Max(0, pos)
+}
+
+// parseDuration parses an unsigned time expression, e.g. the length of a seek.
+func parseDuration(s string) (float64, error) {
+	te, err := parseTimeExpr(s)
+	if err != nil {
+		return 0, err
+	}
+	if te.relative {
+		return 0, fmt.Errorf("bad duration %q: no sign expected", s)
+	}
+	return te.secs, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseTimeExpr(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    timeExpr
+		wantErr bool
+	}{
+		{"30", timeExpr{secs: 30}, false},
+		{"1:00", timeExpr{secs: 60}, false},
+		{"02:15", timeExpr{secs: 135}, false},
+		{"01:02.5", timeExpr{secs: 62.5}, false},
+		{"1:02:03", timeExpr{secs: 3723}, false},
+		{"+0.5", timeExpr{secs: 0.5, relative: true}, false},
+		{"-2", timeExpr{secs: -2, relative: true}, false},
+		{"-1:00", timeExpr{secs: -60, relative: true}, false},
+		{"", timeExpr{}, true},
+		{"+", timeExpr{}, true},
+		{"1:60", timeExpr{}, true},
+		{"1.5:00", timeExpr{}, true},
+		{"1::00", timeExpr{}, true},
+		{"1:2:3:4", timeExpr{}, true},
+		{"+-2", timeExpr{}, true},
+		{"1e3", timeExpr{}, true},
+		{"abc", timeExpr{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := parseTimeExpr(tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_timeExpr_at(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(30.0, timeExpr{secs: 30}.at(100))
+	assert.Equal(98.0, timeExpr{secs: -2, relative: true}.at(100))
+	assert.Equal(0.0, timeExpr{secs: -2, relative: true}.at(1))
+
+	d, err := parseDuration("1:00")
+	assert.NoError(err)
+	assert.Equal(60.0, d)
+	_, err = parseDuration("+10")
+	assert.Error(err)
+}
+
+func Test_splitRange(t *testing.T) {
+	tests := []struct {
+		s, start, end string
+	}{
+		{"01:00-01:30", "01:00", "01:30"},
+		{"01:00 01:30", "01:00", "01:30"},
+		{"+0.5", "+0.5", ""},
+		{"-2", "-2", ""},
+		{"+0 -2", "+0", "-2"},
+		{"01:00--2", "01:00", "-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			start, end, err := splitRange(tt.s)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.start, start)
+			assert.Equal(t, tt.end, end)
+		})
+	}
+	_, _, err := splitRange("1 2 3")
+	assert.Error(t, err)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matm/bmp/pkg/config"
+	"github.com/matm/bmp/pkg/mpd"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+	"golang.org/x/term"
+)
+
+// tuiRefresh is the refresh period of the full-screen UI.
+const tuiRefresh = 250 * time.Millisecond
+
+// Max number of output lines kept by the full-screen UI.
+const tuiMaxMessages = 100
+
+// tuiKeys maps the keys of the full-screen UI to shell commands.
+var tuiKeys = map[string]string{
+	"[":      "[",
+	"]":      "]",
+	"f":      "f",
+	"b":      "b",
+	"\x1b[C": "f",
+	"\x1b[D": "b",
+	"t":      "t",
+	" ":      "t",
+	"r":      "r",
+	"s":      "s",
+	"N":      "N",
+}
+
+const tuiHelp = "[ ] mark  f/b or arrows seek  t/space toggle  r/s autoplay  : command  q shell"
+
+// ANSI escape sequences.
+const (
+	// Also hides the cursor and disables line wrapping.
+	ansiAltScreen  = "\x1b[?1049h\x1b[?25l\x1b[?7l"
+	ansiMainScreen = "\x1b[?7h\x1b[?25h\x1b[?1049l"
+	ansiHome       = "\x1b[H"
+	ansiClearLine  = "\x1b[K"
+	ansiClearDown  = "\x1b[J"
+	ansiBold       = "\x1b[1m"
+	ansiReset      = "\x1b[0m"
+)
+
+// screen is the full-screen terminal UI. Keys run shell commands, any other
+// command can be typed after ':'. Everything printed by the commands is shown
+// at the bottom of the screen.
+type screen struct {
+	mu sync.Mutex
+	// Serializes drawing.
+	drawing sync.Mutex
+	mp      *mpd.Client
+	// User's key bindings, usable in addition to the keys of the screen.
+	km *keymap
+	// Runs a shell command line. Returns true if the program must exit.
+	exec func(line string) bool
+	// Returns a copy of the bookmarks of a song.
+	bookmarks func(song string) []types.Bookmark
+	// Returns a short description of the autoplay state.
+	status func() string
+	// The terminal, while os.Stdout is redirected to the screen.
+	tty *os.File
+	in  *os.File
+	// Colours of the status bar.
+	colors bool
+	// Lines printed by the commands, the latest last.
+	messages []string
+	// Line being typed, and its prompt. Only relevant if editing is true.
+	editing bool
+	prompt  string
+	input   []rune
+}
+
+// run shows the full-screen UI until the user leaves it with q, or the program
+// must exit.
+func (sc *screen) run() error {
+	sc.tty, sc.in = os.Stdout, os.Stdin
+	sc.colors = colorTerm()
+	fd := int(sc.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return eris.Wrap(err, "terminal raw mode")
+	}
+	defer term.Restore(fd, state)
+
+	// Show the output of commands and of the scheduler on screen.
+	r, w, err := os.Pipe()
+	if err != nil {
+		return eris.Wrap(err, "pipe")
+	}
+	stderr := os.Stderr
+	os.Stdout, os.Stderr = w, w
+	log.SetOutput(w)
+	copied := make(chan struct{})
+	go func() {
+		sc.collect(r)
+		close(copied)
+	}()
+	defer func() {
+		w.Close()
+		<-copied
+		r.Close()
+		os.Stdout, os.Stderr = sc.tty, stderr
+		log.SetOutput(stderr)
+	}()
+
+	fmt.Fprint(sc.tty, ansiAltScreen)
+	defer fmt.Fprint(sc.tty, ansiMainScreen)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		t := time.NewTicker(tuiRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				sc.draw()
+			}
+		}
+	}()
+
+	for {
+		sc.draw()
+		key, err := sc.readKey()
+		if err != nil {
+			return err
+		}
+		var line string
+		switch key {
+		case "q", "\x03":
+			return nil
+		case ":":
+			line = sc.readLine(":")
+		default:
+			line = tuiKeys[key]
+			if _, ok := sc.km.keys[key]; ok && line == "" {
+				line = key
+			}
+		}
+		if line == "" {
+			continue
+		}
+		if sc.exec(line) {
+			return nil
+		}
+	}
+}
+
+// collect adds the lines read from r to the messages.
+func (sc *screen) collect(r *os.File) {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		sc.mu.Lock()
+		sc.messages = append(sc.messages, s.Text())
+		if len(sc.messages) > tuiMaxMessages {
+			sc.messages = sc.messages[len(sc.messages)-tuiMaxMessages:]
+		}
+		sc.mu.Unlock()
+	}
+}
+
+// readKey returns the next key pressed. Escape sequences, e.g. arrow keys,
+// are returned whole.
+func (sc *screen) readKey() (string, error) {
+	return readKey(sc.in)
+}
+
+// readKey reads the next key pressed on a terminal in raw mode.
+func readKey(in *os.File) (string, error) {
+	b := make([]byte, 16)
+	n, err := in.Read(b)
+	if err != nil {
+		return "", eris.Wrap(err, "read key")
+	}
+	return string(b[:n]), nil
+}
+
+// Input reads a line typed at the bottom of the screen. Implements
+// types.Prompter so that commands asking questions work in the full-screen UI.
+// Escape cancels, returning an empty line.
+func (sc *screen) Input() string {
+	return sc.readLine("> ")
+}
+
+func (sc *screen) readLine(prompt string) string {
+	sc.mu.Lock()
+	sc.editing, sc.prompt, sc.input = true, prompt, nil
+	sc.mu.Unlock()
+	defer func() {
+		sc.mu.Lock()
+		sc.editing = false
+		sc.mu.Unlock()
+	}()
+	for {
+		sc.draw()
+		key, err := sc.readKey()
+		if err != nil {
+			return ""
+		}
+		sc.mu.Lock()
+		switch key {
+		case "\r", "\n":
+			line := string(sc.input)
+			sc.mu.Unlock()
+			return line
+		case "\x1b", "\x03":
+			sc.mu.Unlock()
+			return ""
+		case "\x7f", "\b":
+			if len(sc.input) > 0 {
+				sc.input = sc.input[:len(sc.input)-1]
+			}
+		default:
+			if !strings.HasPrefix(key, "\x1b") {
+				sc.input = append(sc.input, []rune(key)...)
+			}
+		}
+		sc.mu.Unlock()
+	}
+}
+
+// bar returns the status bar fitting the screen width.
+func (sc *screen) bar(width int) statusBar {
+	return statusBar{width: width - 2, colors: sc.colors, labels: true}
+}
+
+// draw renders the whole screen.
+func (sc *screen) draw() {
+	sc.drawing.Lock()
+	defer sc.drawing.Unlock()
+	width, height, err := term.GetSize(int(sc.tty.Fd()))
+	if err != nil || width < 20 || height < 8 {
+		width, height = 80, 24
+	}
+	lines := make([]string, 0, height)
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	st, err := sc.mp.Status()
+	var song *types.Song
+	if err == nil {
+		song, err = sc.mp.CurrentSong()
+	}
+	switch {
+	case err == types.ErrNoSong:
+		add("%sbmp%s  no song playing", ansiBold, ansiReset)
+		add("")
+		add("%s", sc.status())
+	case err != nil:
+		add("%sbmp%s  MPD error: %v", ansiBold, ansiReset, err)
+	default:
+		add("%sbmp%s  [%s] %s", ansiBold, ansiReset, st.State, songLabel(*song))
+		add("%s", song.File)
+		info := sc.status()
+		if vol := volumeIndicator(st.Volume); vol != "" {
+			info = vol + "  " + info
+		}
+		add("%s", info)
+		add("")
+		marks := sc.bookmarks(song.File)
+		if bar := sc.bar(width).render(st.Elapsed, st.Duration, marks); bar != "" {
+			add(" %s", bar)
+		}
+		add("")
+		if len(marks) == 0 {
+			add("No bookmarks")
+		}
+		for k, bm := range marks {
+			cur := " "
+			start, err1 := config.ParseTime(bm.Start)
+			end, err2 := config.ParseTime(bm.End)
+			if err1 == nil && err2 == nil && st.Elapsed >= start && st.Elapsed < end {
+				cur = ">"
+			}
+			add("%s %d\t%s", cur, k+1, config.FormatRange(bm))
+		}
+	}
+
+	sc.mu.Lock()
+	footer := tuiHelp
+	if sc.editing {
+		footer = sc.prompt + string(sc.input) + "_"
+	}
+	// Latest messages fill the space left.
+	room := height - len(lines) - 2
+	msgs := sc.messages
+	if room < 0 {
+		room = 0
+	}
+	if len(msgs) > room {
+		msgs = msgs[len(msgs)-room:]
+	}
+	add("")
+	for _, m := range msgs {
+		add("%s", m)
+	}
+	sc.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString(ansiHome)
+	for k, l := range lines {
+		if k >= height-1 {
+			break
+		}
+		b.WriteString(l + ansiClearLine + "\r\n")
+	}
+	b.WriteString(ansiClearDown)
+	fmt.Fprintf(&b, "\x1b[%d;1H%s%s", height, footer, ansiClearLine)
+	fmt.Fprint(sc.tty, b.String())
+}
+
+func (s *session) fullScreen(args []string) error {
+	if _, ok := s.p.(*screen); ok {
+		// Already there.
+		return nil
+	}
+	s.tui()
+	return nil
+}
+
+// tui runs the full-screen UI until the user leaves it.
+func (s *session) tui() {
+	prompter := s.p
+	sc := &screen{
+		mp: s.pmp,
+		km: s.km,
+		exec: func(line string) bool {
+			s.exec(line)
+			s.autosave()
+			return s.done
+		},
+		bookmarks: s.bookmarks,
+		status: func() string {
+			if s.sched.previewing() {
+				return "autoplay: preview"
+			}
+			if s.sched.running() {
+				return fmt.Sprintf("autoplay: %s", s.sched.currentMode())
+			}
+			return "autoplay: off"
+		},
+	}
+	// Questions are asked on screen.
+	s.p = sc
+	defer func() { s.p = prompter }()
+	if err := sc.run(); err != nil {
+		logError(err)
+	}
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// FileStore keeps every collection in a bookmarks file. A collection name is
+// the path of its file, relative to the store directory unless absolute.
+type FileStore struct {
+	dir string
+	saves
+}
+
+// NewFileStore returns a store of the bookmarks files in dir.
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+func (s *FileStore) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(s.dir, name)
+}
+
+// Load reads a bookmarks file.
+func (s *FileStore) Load(name string) (types.BookmarkSet, []string, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "load")
+	}
+	defer f.Close()
+	return ParseBookmarkFileOrdered(f)
+}
+
+// Save writes a bookmarks file. The previous file is replaced atomically.
+func (s *FileStore) Save(name string, bs types.BookmarkSet, order []string) error {
+	path := s.path(name)
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return eris.Wrap(err, "save")
+	}
+	defer os.Remove(f.Name())
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode()
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return eris.Wrap(err, "save")
+	}
+	if _, err := WriteBookmarkFile(f, bs, order); err != nil {
+		f.Close()
+		return eris.Wrap(err, "save")
+	}
+	if err := f.Close(); err != nil {
+		return eris.Wrap(err, "save")
+	}
+	// Recorded before renaming, so that watching never sees the new file as
+	// someone else's.
+	fp, err := fingerprint(f.Name())
+	if err != nil {
+		return err
+	}
+	s.record(name, fp)
+	if err := os.Rename(f.Name(), path); err != nil {
+		return eris.Wrap(err, "save")
+	}
+	return nil
+}
+
+// Collections lists the files of the store directory. Hidden files are
+// skipped.
+func (s *FileStore) Collections() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, eris.Wrap(err, "collections")
+	}
+	names := make([]string, 0)
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// fingerprint identifies the content of a file by its modification time and
+// size. Kept by renaming.
+func fingerprint(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", eris.Wrap(err, "stat")
+	}
+	return fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size()), nil
+}
+
+// watchSettle is how long a watched file must stay unchanged before being
+// checked, since editors write files in several steps.
+var watchSettle = 100 * time.Millisecond
+
+// Watch gets notified of changes to a bookmarks file by the operating
+// system, checking its modification time once it settles. Falls back to
+// polling if notifications are not available.
+func (s *FileStore) Watch(name string, fn func()) (func(), error) {
+	path := s.path(name)
+	check := func() (string, error) { return fingerprint(path) }
+	last, err := check()
+	if err != nil {
+		return nil, err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return s.poll(name, check, fn)
+	}
+	// The directory is watched since files are often replaced by renaming
+	// another one, as done by Save.
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return s.poll(name, check, fn)
+	}
+	go func() {
+		var settle <-chan time.Time
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == filepath.Clean(path) {
+					settle = time.After(watchSettle)
+				}
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			case <-settle:
+				settle = nil
+				fp, err := check()
+				if err != nil || fp == last {
+					continue
+				}
+				last = fp
+				if !s.own(name, fp) {
+					fn()
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { w.Close() }) }, nil
+}
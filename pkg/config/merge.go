@@ -0,0 +1,89 @@
+package config
+
+import (
+	"sort"
+
+	"github.com/matm/bmp/pkg/types"
+)
+
+// CloneSet returns a deep copy of a bookmark set.
+func CloneSet(bs types.BookmarkSet) types.BookmarkSet {
+	res := make(types.BookmarkSet, len(bs))
+	for song, bms := range bs {
+		res[song] = append([]types.Bookmark(nil), bms...)
+	}
+	return res
+}
+
+// sameRanges returns true if both songs have the same ranges. A missing song
+// has none.
+func sameRanges(a, b []types.Bookmark) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge merges the changes made to a bookmark set by two sides, ours and
+// theirs, since their common version base. A song changed by one side only
+// takes the changes of that side. A song changed differently by both sides
+// is a conflict: it keeps our ranges in the merged set and is returned in
+// the sorted conflicts.
+func Merge(base, ours, theirs types.BookmarkSet) (types.BookmarkSet, []string) {
+	merged := make(types.BookmarkSet)
+	conflicts := make([]string, 0)
+	songs := make(map[string]bool)
+	for _, bs := range []types.BookmarkSet{base, ours, theirs} {
+		for song := range bs {
+			songs[song] = true
+		}
+	}
+	for song := range songs {
+		b, o, t := base[song], ours[song], theirs[song]
+		_, inOurs := ours[song]
+		_, inTheirs := theirs[song]
+		switch {
+		case sameRanges(o, b) && sameRanges(t, b):
+			// Unchanged, or left without ranges by either side.
+			if inOurs && inTheirs {
+				merged[song] = o
+			}
+		case sameRanges(o, b):
+			if inTheirs {
+				merged[song] = t
+			}
+		case sameRanges(t, b), sameRanges(o, t):
+			if inOurs {
+				merged[song] = o
+			}
+		default:
+			conflicts = append(conflicts, song)
+			if inOurs {
+				merged[song] = o
+			}
+		}
+	}
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// MergeOrder returns the order of the songs of a merged set: their order,
+// followed by our songs they don't have.
+func MergeOrder(ours, theirs []string) []string {
+	seen := make(map[string]bool)
+	order := make([]string, 0, len(theirs))
+	for _, songs := range [][]string{theirs, ours} {
+		for _, song := range songs {
+			if !seen[song] {
+				order = append(order, song)
+				seen[song] = true
+			}
+		}
+	}
+	return order
+}
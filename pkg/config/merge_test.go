@@ -0,0 +1,54 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	r := func(start, end string) []types.Bookmark {
+		return []types.Bookmark{{Start: start, End: end}}
+	}
+	base := types.BookmarkSet{
+		"a.mp3": r("00:10", "00:20"),
+		"b.mp3": r("00:10", "00:20"),
+		"c.mp3": r("00:10", "00:20"),
+		"d.mp3": r("00:10", "00:20"),
+		"g.mp3": r("00:10", "00:20"),
+	}
+	ours := CloneSet(base)
+	ours["b.mp3"][0].End = "00:25"
+	ours["c.mp3"][0].Start = "00:05"
+	ours["g.mp3"][0].Rating = 3
+	delete(ours, "d.mp3")
+	ours["e.mp3"] = r("01:00", "01:10")
+	theirs := CloneSet(base)
+	theirs["a.mp3"] = append(theirs["a.mp3"], types.Bookmark{Start: "01:00", End: "01:10"})
+	theirs["c.mp3"][0].Start = "00:08"
+	theirs["g.mp3"][0].Rating = 3
+	theirs["f.mp3"] = r("02:00", "02:10")
+	assert.Equal("00:20", base["b.mp3"][0].End, "deep copy")
+
+	merged, conflicts := Merge(base, ours, theirs)
+	assert.Equal(types.BookmarkSet{
+		"a.mp3": theirs["a.mp3"],
+		"b.mp3": ours["b.mp3"],
+		"c.mp3": ours["c.mp3"],
+		"e.mp3": ours["e.mp3"],
+		"f.mp3": theirs["f.mp3"],
+		"g.mp3": ours["g.mp3"],
+	}, merged)
+	assert.Equal([]string{"c.mp3"}, conflicts)
+
+	merged, conflicts = Merge(base, base, theirs)
+	assert.Equal(theirs, merged, "unchanged on our side")
+	assert.Empty(conflicts)
+}
+
+func TestMergeOrder(t *testing.T) {
+	assert.Equal(t, []string{"b", "a", "c"}, MergeOrder([]string{"a", "c", "b"}, []string{"b", "a"}))
+}
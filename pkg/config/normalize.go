@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/matm/bmp/pkg/types"
+)
+
+// span is a bookmark with its boundaries converted to seconds.
+type span struct {
+	start, end float64
+	bm         types.Bookmark
+}
+
+// NormalizeBookmarks sorts the time ranges of a song, merges overlapping or
+// adjacent ranges and drops zero-length ones. Reversed ranges are swapped.
+//
+// A range still being defined (no end time) or with an invalid time format is
+// left untouched and moved to the end of the list.
+//
+// The normalized list is returned along with a description of every change
+// made. No change means the list was already normalized.
+func NormalizeBookmarks(bms []types.Bookmark) ([]types.Bookmark, []string) {
+	changes := make([]string, 0)
+	spans := make([]span, 0, len(bms))
+	rest := make([]types.Bookmark, 0)
+	for _, bm := range bms {
+		if bm.End == "" {
+			rest = append(rest, bm)
+			continue
+		}
+		st, err := ParseTime(bm.Start)
+		if err != nil {
+			rest = append(rest, bm)
+			continue
+		}
+		ed, err := ParseTime(bm.End)
+		if err != nil {
+			rest = append(rest, bm)
+			continue
+		}
+		if ed < st {
+			changes = append(changes, fmt.Sprintf("swapped reversed range %s-%s", bm.Start, bm.End))
+			st, ed = ed, st
+			bm.Start, bm.End = bm.End, bm.Start
+		}
+		if st == ed {
+			changes = append(changes, fmt.Sprintf("dropped zero-length range %s-%s", bm.Start, bm.End))
+			continue
+		}
+		spans = append(spans, span{start: st, end: ed, bm: bm})
+	}
+	sorted := sort.SliceIsSorted(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	if !sorted {
+		sort.SliceStable(spans, func(i, j int) bool {
+			return spans[i].start < spans[j].start
+		})
+		changes = append(changes, "sorted ranges by start time")
+	}
+	merged := make([]span, 0, len(spans))
+	for _, sp := range spans {
+		if len(merged) == 0 {
+			merged = append(merged, sp)
+			continue
+		}
+		last := &merged[len(merged)-1]
+		if sp.start > last.end {
+			merged = append(merged, sp)
+			continue
+		}
+		// Overlapping or adjacent ranges.
+		prev := fmt.Sprintf("%s-%s", last.bm.Start, last.bm.End)
+		if sp.end > last.end {
+			last.end = sp.end
+			last.bm.End = sp.bm.End
+			last.bm.FadeOut = sp.bm.FadeOut
+		}
+		if sp.bm.Rating > last.bm.Rating {
+			last.bm.Rating = sp.bm.Rating
+		}
+		changes = append(changes, fmt.Sprintf("merged %s and %s-%s into %s-%s",
+			prev, sp.bm.Start, sp.bm.End, last.bm.Start, last.bm.End))
+	}
+	res := make([]types.Bookmark, 0, len(merged)+len(rest))
+	for _, sp := range merged {
+		res = append(res, sp.bm)
+	}
+	res = append(res, rest...)
+	return res, changes
+}
+
+// NormalizeBookmarkSet normalizes the ranges of every song in place. Songs left
+// without any range are removed from the set. Each change reported is prefixed
+// with the song name.
+func NormalizeBookmarkSet(bs types.BookmarkSet) []string {
+	songs := make([]string, 0, len(bs))
+	for song := range bs {
+		songs = append(songs, song)
+	}
+	sort.Strings(songs)
+	changes := make([]string, 0)
+	for _, song := range songs {
+		bms, chs := NormalizeBookmarks(bs[song])
+		for _, ch := range chs {
+			changes = append(changes, fmt.Sprintf("%s: %s", song, ch))
+		}
+		if len(bms) == 0 {
+			delete(bs, song)
+			changes = append(changes, fmt.Sprintf("%s: removed song without any range", song))
+			continue
+		}
+		bs[song] = bms
+	}
+	return changes
+}
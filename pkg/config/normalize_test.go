@@ -0,0 +1,75 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		name    string
+		bms     []types.Bookmark
+		want    []types.Bookmark
+		changes int
+	}{
+		{"empty list", []types.Bookmark{}, []types.Bookmark{}, 0},
+		{"already normalized",
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "01:00", End: "01:30"}},
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "01:00", End: "01:30"}}, 0},
+		{"out of order",
+			[]types.Bookmark{{Start: "01:00", End: "01:30"}, {Start: "00:10", End: "00:20"}},
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "01:00", End: "01:30"}}, 1},
+		{"overlapping",
+			[]types.Bookmark{{Start: "00:10", End: "00:40"}, {Start: "00:30", End: "01:00"}},
+			[]types.Bookmark{{Start: "00:10", End: "01:00"}}, 1},
+		{"adjacent",
+			[]types.Bookmark{{Start: "00:10", End: "00:30"}, {Start: "00:30", End: "01:00"}},
+			[]types.Bookmark{{Start: "00:10", End: "01:00"}}, 1},
+		{"included",
+			[]types.Bookmark{{Start: "00:10", End: "01:00"}, {Start: "00:20", End: "00:30"}},
+			[]types.Bookmark{{Start: "00:10", End: "01:00"}}, 1},
+		{"duplicate",
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "00:10", End: "00:20"}},
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}}, 1},
+		{"zero-length",
+			[]types.Bookmark{{Start: "00:10", End: "00:10"}, {Start: "01:00", End: "01:30"}},
+			[]types.Bookmark{{Start: "01:00", End: "01:30"}}, 1},
+		{"reversed",
+			[]types.Bookmark{{Start: "00:20", End: "00:10"}},
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}}, 1},
+		{"tenths of a second",
+			[]types.Bookmark{{Start: "00:10.5", End: "00:20"}, {Start: "00:19.9", End: "00:30.2"}, {Start: "00:30.3", End: "00:40"}},
+			[]types.Bookmark{{Start: "00:10.5", End: "00:30.2"}, {Start: "00:30.3", End: "00:40"}}, 1},
+		{"open range kept last",
+			[]types.Bookmark{{Start: "02:00"}, {Start: "00:10", End: "00:20"}},
+			[]types.Bookmark{{Start: "00:10", End: "00:20"}, {Start: "02:00"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := NormalizeBookmarks(tt.bms)
+			assert.Equal(tt.want, got)
+			assert.Len(changes, tt.changes)
+		})
+	}
+}
+
+func TestNormalizeBookmarkSet(t *testing.T) {
+	assert := assert.New(t)
+
+	bs := types.BookmarkSet{
+		"a.mp3": {{Start: "00:10", End: "00:10"}},
+		"b.mp3": {{Start: "00:30", End: "00:40"}, {Start: "00:10", End: "00:35"}},
+	}
+	changes := NormalizeBookmarkSet(bs)
+	assert.NotContains(bs, "a.mp3")
+	assert.Equal([]types.Bookmark{{Start: "00:10", End: "00:40"}}, bs["b.mp3"])
+	if assert.Len(changes, 4) {
+		assert.Equal("a.mp3: dropped zero-length range 00:10-00:10", changes[0])
+		assert.Equal("a.mp3: removed song without any range", changes[1])
+		assert.Equal("b.mp3: sorted ranges by start time", changes[2])
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/matm/bmp/pkg/types"
 	"github.com/rotisserie/eris"
@@ -18,14 +21,136 @@ var (
 	// ErrOrphanRange is an error when time ranges are found but without any previous
 	// song name.
 	ErrOrphanRange = errors.New("orphan ranges, missing song")
+	// ErrBadAttribute is an error when a time range has an attribute with an
+	// invalid value.
+	ErrBadAttribute = errors.New("bad range attribute")
+	// ErrBadTags is an error when the tags of a song can't be parsed.
+	ErrBadTags = errors.New("bad song tags")
 )
 
+// MaxRating is the highest rating a bookmark can have.
+const MaxRating = 5
+
+var (
+	attrRE = regexp.MustCompile(`^([a-z]+)=(.*)$`)
+	timeRE = regexp.MustCompile(`^([0-9]{2}:[0-9]{2}(?:\.[0-9])?)-([0-9]{2}:[0-9]{2}(?:\.[0-9])?)(.*)$`)
+	// A time of a range, with an optional tenth of a second.
+	clockRE = regexp.MustCompile(`^([0-9]{2}):([0-5][0-9])(?:\.([0-9]))?$`)
+)
+
+// ParseTime returns the number of seconds of a time of a range, e.g. 01:02
+// or 01:02.5.
+func ParseTime(t string) (float64, error) {
+	ms := clockRE.FindStringSubmatch(t)
+	if ms == nil {
+		return -1, eris.Errorf("bad time format %q", t)
+	}
+	min, _ := strconv.Atoi(ms[1])
+	sec, _ := strconv.Atoi(ms[2])
+	tenths := 0
+	if ms[3] != "" {
+		tenths, _ = strconv.Atoi(ms[3])
+	}
+	return float64(min*60+sec) + float64(tenths)/10, nil
+}
+
+// FormatTime returns a number of seconds as a time of a range, rounded to the
+// tenth of a second. The tenth is omitted if zero, e.g. 01:02 and 01:02.5.
+func FormatTime(secs float64) string {
+	tenths := int(math.Round(math.Max(0, secs) * 10))
+	if tenths%10 == 0 {
+		return fmt.Sprintf("%02d:%02d", tenths/600, tenths/10%60)
+	}
+	return fmt.Sprintf("%02d:%02d.%d", tenths/600, tenths/10%60, tenths%10)
+}
+
+// ParseRange parses a time range followed by optional attributes, as found
+// on a line of a bookmarks file.
+func ParseRange(s string) (types.Bookmark, error) {
+	times := timeRE.FindStringSubmatch(s)
+	if times == nil {
+		return types.Bookmark{}, eris.Wrap(ErrMissingRanges, s)
+	}
+	bk := types.Bookmark{
+		Start: times[1],
+		End:   times[2],
+	}
+	if err := parseAttributes(&bk, times[3]); err != nil {
+		return types.Bookmark{}, err
+	}
+	return bk, nil
+}
+
+// FormatRange returns a time range with its attributes, as written on a line
+// of a bookmarks file.
+func FormatRange(bk types.Bookmark) string {
+	return fmt.Sprintf("%s-%s%s", bk.Start, bk.End, FormatAttributes(bk))
+}
+
+// parseAttributes sets the optional key=value attributes found after a time
+// range. Unknown keys are ignored so that free text can follow a range.
+func parseAttributes(bk *types.Bookmark, s string) error {
+	for _, field := range strings.Fields(s) {
+		kv := attrRE.FindStringSubmatch(field)
+		if kv == nil {
+			continue
+		}
+		switch kv[1] {
+		case "rating":
+			n, err := strconv.Atoi(kv[2])
+			if err != nil || n < 0 || n > MaxRating {
+				return eris.Wrap(ErrBadAttribute, field)
+			}
+			bk.Rating = n
+		case "fadein", "fadeout":
+			f, err := strconv.ParseFloat(kv[2], 64)
+			if err != nil || f < 0 {
+				return eris.Wrap(ErrBadAttribute, field)
+			}
+			if f == 0 {
+				f = types.NoFade
+			}
+			if kv[1] == "fadein" {
+				bk.FadeIn = f
+			} else {
+				bk.FadeOut = f
+			}
+		}
+	}
+	return nil
+}
+
+// FormatAttributes returns the attributes of a bookmark as written after its
+// time range in a bookmarks file, with a leading space. Empty if the bookmark
+// has no attribute set.
+func FormatAttributes(bk types.Bookmark) string {
+	var b strings.Builder
+	if bk.Rating > 0 {
+		fmt.Fprintf(&b, " rating=%d", bk.Rating)
+	}
+	if bk.FadeIn != 0 {
+		fmt.Fprintf(&b, " fadein=%g", math.Max(0, bk.FadeIn))
+	}
+	if bk.FadeOut != 0 {
+		fmt.Fprintf(&b, " fadeout=%g", math.Max(0, bk.FadeOut))
+	}
+	return b.String()
+}
+
 // ParseBookmarkFile reads a bookmarks file and loads all bookmark entries.
 func ParseBookmarkFile(r io.Reader) (types.BookmarkSet, error) {
+	bms, _, err := ParseBookmarkFileOrdered(r)
+	return bms, err
+}
+
+// ParseBookmarkFileOrdered is like ParseBookmarkFile but also returns the song
+// names in the order they appear in the file.
+func ParseBookmarkFileOrdered(r io.Reader) (types.BookmarkSet, []string, error) {
 	if r == nil {
-		return nil, eris.New("nil reader")
+		return nil, nil, eris.New("nil reader")
 	}
 	bms := make(types.BookmarkSet)
+	order := make([]string, 0)
 
 	// File format is
 	// song: mpd_relative_path_to_song.mp3
@@ -33,20 +158,30 @@ func ParseBookmarkFile(r io.Reader) (types.BookmarkSet, error) {
 	// time_start:time_end
 	// # This is a comment. Will be ignored.
 	// song: another_song.flac
+	// tags: artist="Metallica" title="The Unforgiven" duration="387"
 	// time_start:time_end
 	// ...
 	// Example:
 	// song: metal/Metallica/BlackAlbum/the_unforgiven.mp3
 	// 01:02-01:03
-	// 01:34-02:12
+	// 01:34-02:12 rating=4
+	//
+	// The optional tags: line records the tags of the song, to find it again if
+	// moved in the music library.
+	//
+	// A time range can be followed by optional key=value attributes:
+	// rating=N    rating of the range, from 1 to 5
+	// fadein=S    fade-in duration in seconds when the range starts playing
+	// fadeout=S   fade-out duration in seconds before the range ends
 
 	songRE := regexp.MustCompile(`^song: *(.*)$`)
+	tagsRE := regexp.MustCompile(`^tags: *(.*)$`)
 	commentRE := regexp.MustCompile(`^#`)
-	timeRE := regexp.MustCompile(`^([0-9]{2}:[0-9]{2})-([0-9]{2}:[0-9]{2})`)
 
 	sc := bufio.NewScanner(r)
 	numSongs, numBookmarks := 0, 0
 	var songName string
+	tags := make(map[string]types.SongTags)
 	for sc.Scan() {
 		line := sc.Text()
 		switch {
@@ -55,13 +190,19 @@ func ParseBookmarkFile(r io.Reader) (types.BookmarkSet, error) {
 			songName = sn[len(sn)-1]
 			if _, ok := bms[songName]; !ok {
 				bms[songName] = make([]types.Bookmark, 0)
+				order = append(order, songName)
 			}
 			numSongs++
+		case tagsRE.MatchString(line):
+			t, err := ParseTags(tagsRE.FindStringSubmatch(line)[1])
+			if err != nil {
+				return nil, nil, eris.Wrap(err, songName)
+			}
+			tags[songName] = t
 		case timeRE.MatchString(line):
-			times := timeRE.FindStringSubmatch(line)
-			bk := types.Bookmark{
-				Start: times[len(times)-2],
-				End:   times[len(times)-1],
+			bk, err := ParseRange(line)
+			if err != nil {
+				return nil, nil, eris.Wrap(err, songName)
 			}
 			bms[songName] = append(bms[songName], bk)
 			numBookmarks++
@@ -71,19 +212,28 @@ func ParseBookmarkFile(r io.Reader) (types.BookmarkSet, error) {
 	}
 	err := sc.Err()
 	if err != nil {
-		return nil, eris.Wrap(err, "bookmark scan")
+		return nil, nil, eris.Wrap(err, "bookmark scan")
 	}
 	// Various syntax checks.
 	for song := range bms {
 		if len(bms[song]) == 0 {
 			// No time ranges provided.
-			return nil, eris.Wrap(ErrMissingRanges, song)
+			return nil, nil, eris.Wrap(ErrMissingRanges, song)
 		}
 	}
 	if _, ok := bms[""]; ok {
 		// Orphan ranges.
-		return nil, eris.Wrap(ErrOrphanRange, fmt.Sprintf("%v", bms[""]))
+		orphans := make([]string, 0, len(bms[""]))
+		for _, bk := range bms[""] {
+			orphans = append(orphans, fmt.Sprintf("{%s %s}", bk.Start, bk.End))
+		}
+		return nil, nil, eris.Wrap(ErrOrphanRange, fmt.Sprintf("[%s]", strings.Join(orphans, " ")))
+	}
+	for song, t := range tags {
+		for k := range bms[song] {
+			bms[song][k].Tags = t
+		}
 	}
 	fmt.Printf("Loaded %d songs, %d bookmarks\n", numSongs, numBookmarks)
-	return bms, nil
+	return bms, order, nil
 }
@@ -92,6 +92,53 @@ song: some/path/intro.mp3
 				}
 			}
 		}},
+		{"range with rating and free text", func() io.Reader {
+			c := `
+song: some/path/intro.mp3
+01:00-01:30 rating=4 best solo ever
+02:00-02:30 just text
+			`
+			return strings.NewReader(c)
+		}, func(err error, bs types.BookmarkSet) {
+			assert.NoError(err)
+			title := "some/path/intro.mp3"
+			if assert.Contains(bs, title) && assert.Len(bs[title], 2) {
+				assert.Equal(types.Bookmark{Start: "01:00", End: "01:30", Rating: 4}, bs[title][0])
+				assert.Equal(types.Bookmark{Start: "02:00", End: "02:30"}, bs[title][1])
+			}
+		}},
+		{"range with fades", func() io.Reader {
+			c := `
+song: some/path/intro.mp3
+01:00-01:30 fadein=2 fadeout=1.5
+			`
+			return strings.NewReader(c)
+		}, func(err error, bs types.BookmarkSet) {
+			assert.NoError(err)
+			title := "some/path/intro.mp3"
+			if assert.Contains(bs, title) && assert.Len(bs[title], 1) {
+				assert.Equal(types.Bookmark{Start: "01:00", End: "01:30", FadeIn: 2, FadeOut: 1.5}, bs[title][0])
+			}
+		}},
+		{"bad fade", func() io.Reader {
+			c := `
+song: some/path/intro.mp3
+01:00-01:30 fadeout=-1
+			`
+			return strings.NewReader(c)
+		}, func(err error, bs types.BookmarkSet) {
+			assert.ErrorIs(err, ErrBadAttribute)
+		}},
+		{"bad rating", func() io.Reader {
+			c := `
+song: some/path/intro.mp3
+01:00-01:30 rating=9
+			`
+			return strings.NewReader(c)
+		}, func(err error, bs types.BookmarkSet) {
+			assert.ErrorIs(err, ErrBadAttribute)
+			assert.Empty(bs)
+		}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -102,3 +149,89 @@ song: some/path/intro.mp3
 		})
 	}
 }
+
+func TestParseBookmarkFileOrdered(t *testing.T) {
+	assert := assert.New(t)
+
+	c := `
+song: b.mp3
+01:00-01:30
+song: a.mp3
+02:00-02:30
+song: b.mp3
+03:00-03:30
+`
+	bs, order, err := ParseBookmarkFileOrdered(strings.NewReader(c))
+	assert.NoError(err)
+	assert.Equal([]string{"b.mp3", "a.mp3"}, order)
+	assert.Len(bs["b.mp3"], 2)
+}
+
+func TestFormatAttributes(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", FormatAttributes(types.Bookmark{Start: "01:00", End: "01:30"}))
+	assert.Equal(" rating=3", FormatAttributes(types.Bookmark{Start: "01:00", End: "01:30", Rating: 3}))
+	assert.Equal(" fadein=1.5 fadeout=3", FormatAttributes(types.Bookmark{Start: "01:00", End: "01:30", FadeIn: 1.5, FadeOut: 3}))
+	assert.Equal(" fadein=0", FormatAttributes(types.Bookmark{Start: "01:00", End: "01:30", FadeIn: types.NoFade}))
+
+	bk, err := ParseRange("01:00-01:30 fadein=0 fadeout=2")
+	assert.NoError(err)
+	assert.Equal(float64(types.NoFade), bk.FadeIn)
+	assert.Equal(" fadein=0 fadeout=2", FormatAttributes(bk))
+}
+
+func TestParseTime(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		time string
+		secs float64
+	}{
+		{"00:00", 0},
+		{"01:02", 62},
+		{"01:02.5", 62.5},
+		{"99:59.9", 5999.9},
+	}
+	for _, tt := range tests {
+		secs, err := ParseTime(tt.time)
+		assert.NoError(err)
+		assert.InDelta(tt.secs, secs, 1e-9)
+		assert.Equal(tt.time, FormatTime(tt.secs))
+	}
+	for _, bad := range []string{"", "1:02", "01:60", "01:02.55", "01:02."} {
+		_, err := ParseTime(bad)
+		assert.Error(err, bad)
+	}
+	assert.Equal("01:02.3", FormatTime(62.26))
+	assert.Equal("01:03", FormatTime(62.96))
+	assert.Equal("00:00", FormatTime(-1))
+
+	bk, err := ParseRange("01:02.5-01:10 rating=2")
+	assert.NoError(err)
+	assert.Equal(types.Bookmark{Start: "01:02.5", End: "01:10", Rating: 2}, bk)
+}
+
+func TestParseTags(t *testing.T) {
+	assert := assert.New(t)
+
+	tags := types.SongTags{
+		Artist:    `Guns N' "Roses"`,
+		Title:     "November Rain",
+		Duration:  537,
+		MBTrackID: "abc",
+	}
+	s := FormatTags(tags)
+	assert.Equal(`artist="Guns N' \"Roses\"" title="November Rain" duration="537" mb_trackid="abc"`, s)
+	got, err := ParseTags(s)
+	assert.NoError(err)
+	assert.Equal(tags, got)
+
+	_, err = ParseTags(`duration="long"`)
+	assert.ErrorIs(err, ErrBadTags)
+
+	bs, err := ParseBookmarkFile(strings.NewReader("song: a.mp3\ntags: " + s + "\n01:00-01:30\n02:00-02:10\n"))
+	assert.NoError(err)
+	assert.Equal(tags, bs["a.mp3"][0].Tags)
+	assert.Equal(tags, bs["a.mp3"][1].Tags)
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"sort"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// Finder looks songs up in the MPD database. Implemented by mpd.Client.
+type Finder interface {
+	// FindSongs returns the songs having exactly all the given tag values.
+	FindSongs(tags map[string]string) ([]types.Song, error)
+	// SearchSongs returns the songs whose tags contain all the given values,
+	// case insensitive.
+	SearchSongs(tags map[string]string) ([]types.Song, error)
+}
+
+// Move is a song of a bookmark set found at another location of the music
+// library.
+type Move struct {
+	From, To string
+	// Number of other songs matching as well.
+	Others int
+}
+
+// durationSlack is the max difference in seconds between the recorded and
+// the actual duration of a song for them to match.
+const durationSlack = 2
+
+// Resolve looks up the songs of the set missing from the music library, using
+// the tags recorded with their bookmarks. It returns the moves found and the
+// songs that could not be found, both sorted by song name.
+func Resolve(f Finder, bs types.BookmarkSet) ([]Move, []string, error) {
+	moves := make([]Move, 0)
+	missing := make([]string, 0)
+	for _, song := range SongOrder(bs, nil) {
+		found, err := f.FindSongs(map[string]string{"file": song})
+		if err != nil {
+			return nil, nil, eris.Wrap(err, song)
+		}
+		if len(found) > 0 {
+			continue
+		}
+		to, others, err := lookup(f, songTags(bs[song]))
+		if err != nil {
+			return nil, nil, eris.Wrap(err, song)
+		}
+		if to == "" {
+			missing = append(missing, song)
+			continue
+		}
+		moves = append(moves, Move{From: song, To: to, Others: others})
+	}
+	return moves, missing, nil
+}
+
+// lookup finds the song best matching tags. Returns an empty name if none
+// matches.
+func lookup(f Finder, t types.SongTags) (string, int, error) {
+	queries := make([]func() ([]types.Song, error), 0)
+	if t.MBTrackID != "" {
+		queries = append(queries, func() ([]types.Song, error) {
+			return f.FindSongs(map[string]string{"MUSICBRAINZ_TRACKID": t.MBTrackID})
+		})
+	}
+	if t.Title != "" {
+		exact := map[string]string{"title": t.Title}
+		if t.Artist != "" {
+			exact["artist"] = t.Artist
+		}
+		queries = append(queries,
+			func() ([]types.Song, error) { return f.FindSongs(exact) },
+			func() ([]types.Song, error) { return f.SearchSongs(exact) })
+	}
+	for _, q := range queries {
+		songs, err := q()
+		if err != nil {
+			return "", 0, err
+		}
+		if best, others := pickCandidate(t, songs); best != "" {
+			return best, others, nil
+		}
+	}
+	return "", 0, nil
+}
+
+// pickCandidate returns the song best matching tags among songs, and the
+// number of other acceptable candidates. Songs whose duration is too far from
+// the recorded one are discarded.
+func pickCandidate(t types.SongTags, songs []types.Song) (string, int) {
+	type candidate struct {
+		file  string
+		score int
+	}
+	cands := make([]candidate, 0, len(songs))
+	for _, s := range songs {
+		diff := int(s.Duration) - t.Duration
+		if diff < 0 {
+			diff = -diff
+		}
+		if t.Duration > 0 && s.Duration > 0 && diff > durationSlack {
+			continue
+		}
+		score := 0
+		if t.Album != "" && s.Album == t.Album {
+			score += 2
+		}
+		if t.Track != "" && s.Track == t.Track {
+			score++
+		}
+		cands = append(cands, candidate{s.File, score})
+	}
+	if len(cands) == 0 {
+		return "", 0
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].score != cands[j].score {
+			return cands[i].score > cands[j].score
+		}
+		return cands[i].file < cands[j].file
+	})
+	return cands[0].file, len(cands) - 1
+}
+
+// ApplyMoves renames the moved songs of the set, merging their bookmarks with
+// any already recorded at the new location. The updated song order is
+// returned.
+func ApplyMoves(bs types.BookmarkSet, order []string, moves []Move) []string {
+	renamed := make(map[string]string)
+	for _, m := range moves {
+		if _, ok := bs[m.From]; !ok {
+			continue
+		}
+		bs[m.To] = append(bs[m.To], bs[m.From]...)
+		delete(bs, m.From)
+		renamed[m.From] = m.To
+	}
+	res := make([]string, 0, len(order))
+	seen := make(map[string]bool)
+	for _, song := range order {
+		if to, ok := renamed[song]; ok {
+			song = to
+		}
+		if !seen[song] {
+			res = append(res, song)
+			seen[song] = true
+		}
+	}
+	return res
+}
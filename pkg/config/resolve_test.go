@@ -0,0 +1,96 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLibrary is a music database for resolving songs.
+type fakeLibrary []types.Song
+
+func (l fakeLibrary) match(tags map[string]string, eq func(a, b string) bool) []types.Song {
+	res := make([]types.Song, 0)
+	for _, s := range l {
+		vals := map[string]string{
+			"file":                s.File,
+			"artist":              s.Artist,
+			"title":               s.Title,
+			"MUSICBRAINZ_TRACKID": s.MBTrackID,
+		}
+		ok := true
+		for k, v := range tags {
+			if !eq(vals[k], v) {
+				ok = false
+			}
+		}
+		if ok {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func (l fakeLibrary) FindSongs(tags map[string]string) ([]types.Song, error) {
+	return l.match(tags, func(a, b string) bool { return a == b }), nil
+}
+
+func (l fakeLibrary) SearchSongs(tags map[string]string) ([]types.Song, error) {
+	return l.match(tags, func(a, b string) bool {
+		return strings.Contains(strings.ToLower(a), strings.ToLower(b))
+	}), nil
+}
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	lib := fakeLibrary{
+		{File: "here.mp3", Title: "Here"},
+		{File: "new/mb.mp3", Title: "Other title", MBTrackID: "abc"},
+		{File: "new/enter_sandman.mp3", Artist: "Metallica", Title: "Enter Sandman", Album: "Metallica", Duration: 331},
+		{File: "live/enter_sandman.mp3", Artist: "Metallica", Title: "Enter Sandman", Album: "Live", Duration: 400},
+		{File: "new/Unforgiven.mp3", Artist: "Metallica", Title: "The Unforgiven (Remastered)", Duration: 387},
+	}
+	bm := func(tags types.SongTags) []types.Bookmark {
+		return []types.Bookmark{{Start: "00:10", End: "00:20", Tags: tags}}
+	}
+	bs := types.BookmarkSet{
+		"here.mp3":          bm(types.SongTags{}),
+		"old/mb.mp3":        bm(types.SongTags{Title: "Some title", MBTrackID: "abc"}),
+		"old/sandman.mp3":   bm(types.SongTags{Artist: "Metallica", Title: "Enter Sandman", Duration: 330}),
+		"old/unforgive.mp3": bm(types.SongTags{Artist: "metallica", Title: "unforgiven"}),
+		"old/notags.mp3":    bm(types.SongTags{}),
+		"old/gone.mp3":      bm(types.SongTags{Title: "Gone"}),
+	}
+	moves, missing, err := Resolve(lib, bs)
+	assert.NoError(err)
+	sort.Slice(moves, func(i, j int) bool { return moves[i].From < moves[j].From })
+	assert.Equal([]Move{
+		{From: "old/mb.mp3", To: "new/mb.mp3"},
+		{From: "old/sandman.mp3", To: "new/enter_sandman.mp3"},
+		{From: "old/unforgive.mp3", To: "new/Unforgiven.mp3"},
+	}, moves)
+	assert.Equal([]string{"old/gone.mp3", "old/notags.mp3"}, missing)
+}
+
+func TestApplyMoves(t *testing.T) {
+	assert := assert.New(t)
+
+	bs := types.BookmarkSet{
+		"a.mp3": {{Start: "00:10", End: "00:20"}},
+		"b.mp3": {{Start: "01:10", End: "01:20"}},
+		"c.mp3": {{Start: "02:10", End: "02:20"}},
+	}
+	order := ApplyMoves(bs, []string{"a.mp3", "b.mp3", "c.mp3"}, []Move{
+		{From: "a.mp3", To: "new/a.mp3"},
+		{From: "c.mp3", To: "b.mp3"},
+	})
+	assert.Equal([]string{"new/a.mp3", "b.mp3"}, order)
+	assert.Equal(types.BookmarkSet{
+		"new/a.mp3": {{Start: "00:10", End: "00:20"}},
+		"b.mp3":     {{Start: "01:10", End: "01:20"}, {Start: "02:10", End: "02:20"}},
+	}, bs)
+}
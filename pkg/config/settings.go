@@ -0,0 +1,162 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rotisserie/eris"
+)
+
+// ErrUnknownProfile is an error when a profile is not defined in the
+// configuration file.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// DefaultSeekStep is the default seek step in seconds of the f and b commands.
+const DefaultSeekStep = 10
+
+// Defaults of the nudging of range boundaries, in seconds.
+const (
+	DefaultNudgeStep    = 0.5
+	DefaultNudgePreroll = 3
+)
+
+// Profile holds the settings to use a MPD server.
+type Profile struct {
+	// Host name or IP address of the MPD server.
+	Host string `toml:"host"`
+	Port int    `toml:"port"`
+	// Path to the unix socket of the MPD server, used instead of Host and
+	// Port if set.
+	Socket   string `toml:"socket"`
+	Password string `toml:"password"`
+	// Local path to the MPD music directory.
+	MusicDir string `toml:"music_dir"`
+	// Bookmarks file, or collection, loaded at startup.
+	Bookmarks string `toml:"bookmarks"`
+	// Seek step in seconds of the f and b commands.
+	Seek int `toml:"seek"`
+	// Save bookmarks to their collection after every change.
+	Autosave bool `toml:"autosave"`
+	// Step in seconds of the nudging of range boundaries.
+	Nudge float64 `toml:"nudge"`
+	// Seconds played before a nudged boundary.
+	NudgePreroll float64 `toml:"nudge_preroll"`
+}
+
+// Address returns the address of the MPD server to dial: the unix socket if
+// any, the host otherwise.
+func (p Profile) Address() string {
+	if p.Socket != "" {
+		return p.Socket
+	}
+	return p.Host
+}
+
+// Settings is the content of the configuration file, e.g.
+//
+//	profile = "home"
+//
+//	[profiles.home]
+//	host = "192.168.1.10"
+//	music_dir = "/srv/music"
+//	bookmarks = "~/music/best"
+//
+//	[profiles.studio]
+//	socket = "/run/mpd/socket"
+//	seek = 5
+//	autosave = true
+//	nudge = 0.2
+//
+//	[keys]
+//	m = "["
+//
+//	[aliases]
+//	ff = "f 30"
+type Settings struct {
+	// Profile used when none is given.
+	Profile  string             `toml:"profile"`
+	Profiles map[string]Profile `toml:"profiles"`
+	// Extra key bindings of shell commands: command key by bound key.
+	Keys map[string]string `toml:"keys"`
+	// Shell command lines by alias name.
+	Aliases map[string]string `toml:"aliases"`
+}
+
+// DefaultSettingsPath returns the path of the configuration file,
+// $XDG_CONFIG_HOME/bmp/config.toml.
+func DefaultSettingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", eris.Wrap(err, "config path")
+	}
+	return filepath.Join(dir, "bmp", "config.toml"), nil
+}
+
+// LoadSettings reads a configuration file. A missing file is not an error,
+// empty settings are returned.
+func LoadSettings(path string) (*Settings, error) {
+	s := &Settings{Profiles: make(map[string]Profile)}
+	_, err := toml.DecodeFile(path, s)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, eris.Wrap(err, path)
+	}
+	return s, nil
+}
+
+// FindProfile returns the profile with the given name, or the default profile
+// if name is empty. The zero profile is returned if no profile is defined.
+// Unset values are set to their defaults.
+func (s *Settings) FindProfile(name string) (Profile, error) {
+	if name == "" {
+		name = s.Profile
+	}
+	var p Profile
+	if name != "" {
+		var ok bool
+		p, ok = s.Profiles[name]
+		if !ok {
+			return Profile{}, eris.Wrap(ErrUnknownProfile, name)
+		}
+	}
+	if p.Port == 0 {
+		p.Port = 6600
+	}
+	if p.Seek == 0 {
+		p.Seek = DefaultSeekStep
+	}
+	if p.Nudge == 0 {
+		p.Nudge = DefaultNudgeStep
+	}
+	if p.NudgePreroll == 0 {
+		p.NudgePreroll = DefaultNudgePreroll
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		p.MusicDir = expandHome(p.MusicDir, home)
+		p.Bookmarks = expandHome(p.Bookmarks, home)
+	}
+	return p, nil
+}
+
+// ProfileNames returns the names of all profiles, sorted.
+func (s *Settings) ProfileNames() []string {
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expandHome replaces a leading ~/ in path with the home directory.
+func expandHome(path, home string) string {
+	if len(path) > 1 && path[:2] == "~/" {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
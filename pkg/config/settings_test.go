@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	s, err := LoadSettings(filepath.Join(dir, "missing.toml"))
+	assert.NoError(err)
+	p, err := s.FindProfile("")
+	assert.NoError(err)
+	assert.Equal(Profile{Port: 6600, Seek: DefaultSeekStep, Nudge: DefaultNudgeStep, NudgePreroll: DefaultNudgePreroll}, p)
+
+	path := filepath.Join(dir, "config.toml")
+	err = os.WriteFile(path, []byte(`
+profile = "home"
+
+[profiles.home]
+host = "192.168.1.10"
+music_dir = "/srv/music"
+bookmarks = "best"
+
+[profiles.studio]
+socket = "/run/mpd/socket"
+password = "secret"
+port = 6601
+seek = 5
+autosave = true
+nudge = 0.2
+nudge_preroll = 1.5
+
+[keys]
+m = "["
+"," = "]"
+
+[aliases]
+ff = "f 30"
+`), 0644)
+	assert.NoError(err)
+	s, err = LoadSettings(path)
+	assert.NoError(err)
+	assert.Equal([]string{"home", "studio"}, s.ProfileNames())
+	assert.Equal(map[string]string{"m": "[", ",": "]"}, s.Keys)
+	assert.Equal(map[string]string{"ff": "f 30"}, s.Aliases)
+
+	p, err = s.FindProfile("")
+	assert.NoError(err)
+	assert.Equal(Profile{Host: "192.168.1.10", Port: 6600, MusicDir: "/srv/music", Bookmarks: "best", Seek: 10, Nudge: 0.5, NudgePreroll: 3}, p)
+	assert.Equal("192.168.1.10", p.Address())
+
+	p, err = s.FindProfile("studio")
+	assert.NoError(err)
+	assert.Equal(Profile{Socket: "/run/mpd/socket", Password: "secret", Port: 6601, Seek: 5, Autosave: true, Nudge: 0.2, NudgePreroll: 1.5}, p)
+	assert.Equal("/run/mpd/socket", p.Address())
+
+	_, err = s.FindProfile("office")
+	assert.ErrorIs(err, ErrUnknownProfile)
+
+	assert.NoError(os.WriteFile(path, []byte("profile = \n"), 0644))
+	_, err = LoadSettings(path)
+	assert.Error(err)
+}
+
+func Test_expandHome(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("/home/me/music", expandHome("~/music", "/home/me"))
+	assert.Equal("/srv/music", expandHome("/srv/music", "/home/me"))
+	assert.Equal("~music", expandHome("~music", "/home/me"))
+}
@@ -0,0 +1,286 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+
+	// Pure Go SQLite driver, no cgo needed.
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS collections (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS revisions (
+	id            INTEGER PRIMARY KEY,
+	collection_id INTEGER NOT NULL REFERENCES collections(id),
+	created       INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS bookmarks (
+	revision_id INTEGER NOT NULL REFERENCES revisions(id),
+	position    INTEGER NOT NULL,
+	song        TEXT NOT NULL,
+	start       TEXT NOT NULL,
+	end         TEXT NOT NULL,
+	rating      INTEGER NOT NULL DEFAULT 0,
+	fade_in     REAL NOT NULL DEFAULT 0,
+	fade_out    REAL NOT NULL DEFAULT 0,
+	tags        TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS bookmarks_revision ON bookmarks(revision_id);
+CREATE INDEX IF NOT EXISTS bookmarks_song ON bookmarks(song);
+`
+
+// SQLiteStore keeps collections in a SQLite database. Every save adds a new
+// revision of the collection, previous ones are kept as history.
+type SQLiteStore struct {
+	db *sql.DB
+	saves
+}
+
+// OpenSQLiteStore opens, and creates if needed, a SQLite database of
+// bookmarks.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, eris.Wrap(err, "open database")
+	}
+	// Concurrent writers would get "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, eris.Wrap(err, "create schema")
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// migrate adds the columns missing from databases created by older versions.
+func migrate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('bookmarks')`)
+	if err != nil {
+		return eris.Wrap(err, "migrate")
+	}
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return eris.Wrap(err, "migrate")
+		}
+		cols[name] = true
+	}
+	rows.Close()
+	if !cols["tags"] {
+		if _, err := db.Exec(`ALTER TABLE bookmarks ADD COLUMN tags TEXT NOT NULL DEFAULT ''`); err != nil {
+			return eris.Wrap(err, "migrate")
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// latest returns the ID of the last revision of a collection, or 0 if the
+// collection does not exist.
+func (s *SQLiteStore) latest(name string) (int64, error) {
+	var id sql.NullInt64
+	err := s.db.QueryRow(`
+		SELECT MAX(r.id) FROM revisions r
+		JOIN collections c ON c.id = r.collection_id
+		WHERE c.name = ?`, name).Scan(&id)
+	if err != nil {
+		return 0, eris.Wrap(err, "latest revision")
+	}
+	return id.Int64, nil
+}
+
+func (s *SQLiteStore) loadRevision(id int64) (types.BookmarkSet, []string, error) {
+	rows, err := s.db.Query(`
+		SELECT song, start, end, rating, fade_in, fade_out, tags FROM bookmarks
+		WHERE revision_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "load")
+	}
+	defer rows.Close()
+	bs := make(types.BookmarkSet)
+	order := make([]string, 0)
+	for rows.Next() {
+		var song, tags string
+		var bm types.Bookmark
+		if err := rows.Scan(&song, &bm.Start, &bm.End, &bm.Rating, &bm.FadeIn, &bm.FadeOut, &tags); err != nil {
+			return nil, nil, eris.Wrap(err, "load")
+		}
+		if bm.Tags, err = ParseTags(tags); err != nil {
+			return nil, nil, eris.Wrap(err, song)
+		}
+		if _, ok := bs[song]; !ok {
+			order = append(order, song)
+		}
+		bs[song] = append(bs[song], bm)
+	}
+	return bs, order, eris.Wrap(rows.Err(), "load")
+}
+
+// Load reads the last revision of a collection.
+func (s *SQLiteStore) Load(name string) (types.BookmarkSet, []string, error) {
+	id, err := s.latest(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id == 0 {
+		return nil, nil, eris.Errorf("no such collection %q", name)
+	}
+	return s.loadRevision(id)
+}
+
+// LoadRevision reads a previous revision of a collection.
+func (s *SQLiteStore) LoadRevision(name string, id int64) (types.BookmarkSet, []string, error) {
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM revisions r
+		JOIN collections c ON c.id = r.collection_id
+		WHERE c.name = ? AND r.id = ?`, name, id).Scan(&n)
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "load revision")
+	}
+	if n == 0 {
+		return nil, nil, eris.Errorf("no revision %d for collection %q", id, name)
+	}
+	return s.loadRevision(id)
+}
+
+// Save adds a new revision of a collection. Ranges still being defined are
+// skipped.
+func (s *SQLiteStore) Save(name string, bs types.BookmarkSet, order []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return eris.Wrap(err, "save")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO collections(name) VALUES (?)`, name); err != nil {
+		return eris.Wrap(err, "save")
+	}
+	res, err := tx.Exec(`
+		INSERT INTO revisions(collection_id, created)
+		SELECT id, ? FROM collections WHERE name = ?`, time.Now().Unix(), name)
+	if err != nil {
+		return eris.Wrap(err, "save")
+	}
+	rev, err := res.LastInsertId()
+	if err != nil {
+		return eris.Wrap(err, "save")
+	}
+	pos := 0
+	for _, song := range SongOrder(bs, order) {
+		for _, bm := range bs[song] {
+			if bm.End == "" {
+				continue
+			}
+			_, err := tx.Exec(`
+				INSERT INTO bookmarks(revision_id, position, song, start, end, rating, fade_in, fade_out, tags)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				rev, pos, song, bm.Start, bm.End, bm.Rating, bm.FadeIn, bm.FadeOut, FormatTags(bm.Tags))
+			if err != nil {
+				return eris.Wrap(err, "save")
+			}
+			pos++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return eris.Wrap(err, "save")
+	}
+	s.record(name, fmt.Sprint(rev))
+	return nil
+}
+
+// Collections lists all collections by name.
+func (s *SQLiteStore) Collections() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM collections ORDER BY name`)
+	if err != nil {
+		return nil, eris.Wrap(err, "collections")
+	}
+	defer rows.Close()
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, eris.Wrap(err, "collections")
+		}
+		names = append(names, name)
+	}
+	return names, eris.Wrap(rows.Err(), "collections")
+}
+
+// History lists the revisions of a collection, latest first.
+func (s *SQLiteStore) History(name string) ([]Revision, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id, r.created, COUNT(DISTINCT b.song), COUNT(b.song)
+		FROM revisions r
+		JOIN collections c ON c.id = r.collection_id
+		LEFT JOIN bookmarks b ON b.revision_id = r.id
+		WHERE c.name = ?
+		GROUP BY r.id ORDER BY r.id DESC`, name)
+	if err != nil {
+		return nil, eris.Wrap(err, "history")
+	}
+	defer rows.Close()
+	revs := make([]Revision, 0)
+	for rows.Next() {
+		var rev Revision
+		var created int64
+		if err := rows.Scan(&rev.ID, &created, &rev.Songs, &rev.Ranges); err != nil {
+			return nil, eris.Wrap(err, "history")
+		}
+		rev.Created = time.Unix(created, 0)
+		revs = append(revs, rev)
+	}
+	return revs, eris.Wrap(rows.Err(), "history")
+}
+
+// Query returns the songs whose name contains pattern, case insensitive, in
+// the last revision of every collection.
+func (s *SQLiteStore) Query(pattern string) (map[string][]string, error) {
+	esc := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(pattern)
+	rows, err := s.db.Query(`
+		SELECT DISTINCT c.name, b.song FROM bookmarks b
+		JOIN revisions r ON r.id = b.revision_id
+		JOIN collections c ON c.id = r.collection_id
+		WHERE r.id = (SELECT MAX(id) FROM revisions WHERE collection_id = c.id)
+		AND b.song LIKE ? ESCAPE '\'
+		ORDER BY c.name, b.position`, "%"+esc+"%")
+	if err != nil {
+		return nil, eris.Wrap(err, "query")
+	}
+	defer rows.Close()
+	res := make(map[string][]string)
+	for rows.Next() {
+		var col, song string
+		if err := rows.Scan(&col, &song); err != nil {
+			return nil, eris.Wrap(err, "query")
+		}
+		res[col] = append(res[col], song)
+	}
+	return res, eris.Wrap(rows.Err(), "query")
+}
+
+// Watch polls the last revision of the collection for changes.
+func (s *SQLiteStore) Watch(name string, fn func()) (func(), error) {
+	return s.poll(name, func() (string, error) {
+		id, err := s.latest(name)
+		return fmt.Sprint(id), err
+	}, fn)
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// StickerName is the name of the MPD sticker holding the bookmarks of a song,
+// for the default collection. Other collections use the StickerName:collection
+// sticker.
+const StickerName = "bmp-bookmarks"
+
+// stickerSep separates time ranges in a sticker value, which is a single line.
+const stickerSep = ";"
+
+// Stickers is the subset of the MPD sticker commands needed to store
+// bookmarks. Implemented by mpd.Client.
+type Stickers interface {
+	StickerSet(uri, name, value string) error
+	StickerDelete(uri, name string) error
+	StickerFind(dir, name string) (map[string]string, error)
+	StickerNames() ([]string, error)
+}
+
+// FormatStickerValue returns the time ranges of a song as a sticker value.
+// Ranges still being defined are skipped.
+func FormatStickerValue(bms []types.Bookmark) string {
+	ranges := make([]string, 0, len(bms))
+	for _, bm := range bms {
+		if bm.End == "" {
+			continue
+		}
+		ranges = append(ranges, FormatRange(bm))
+	}
+	return strings.Join(ranges, stickerSep)
+}
+
+// ParseStickerValue reads the time ranges of a song from a sticker value.
+func ParseStickerValue(v string) ([]types.Bookmark, error) {
+	bms := make([]types.Bookmark, 0)
+	for _, r := range strings.Split(v, stickerSep) {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		bm, err := ParseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		bms = append(bms, bm)
+	}
+	return bms, nil
+}
+
+// StickerStore keeps bookmarks in the stickers of the songs of the MPD
+// database, so that all clients of the same server share them. Song order is
+// not stored, songs are sorted by name.
+type StickerStore struct {
+	st Stickers
+	saves
+}
+
+// NewStickerStore returns a store of bookmarks in MPD stickers.
+func NewStickerStore(st Stickers) *StickerStore {
+	return &StickerStore{st: st}
+}
+
+func stickerName(collection string) string {
+	if collection == "" || collection == DefaultCollection {
+		return StickerName
+	}
+	return StickerName + ":" + collection
+}
+
+// Load reads the bookmarks of all songs having a sticker for the collection.
+func (s *StickerStore) Load(name string) (types.BookmarkSet, []string, error) {
+	values, err := s.st.StickerFind("", stickerName(name))
+	if err != nil {
+		return nil, nil, eris.Wrap(err, "load stickers")
+	}
+	bs := make(types.BookmarkSet)
+	for song, v := range values {
+		bms, err := ParseStickerValue(v)
+		if err != nil {
+			return nil, nil, eris.Wrap(err, song)
+		}
+		if len(bms) > 0 {
+			bs[song] = bms
+		}
+	}
+	return bs, SongOrder(bs, nil), nil
+}
+
+// Save writes the bookmarks of every song of the set to its sticker. Stickers
+// of songs no longer in the set are deleted.
+func (s *StickerStore) Save(name string, bs types.BookmarkSet, order []string) error {
+	sn := stickerName(name)
+	current, err := s.st.StickerFind("", sn)
+	if err != nil {
+		return eris.Wrap(err, "save stickers")
+	}
+	for song, bms := range bs {
+		v := FormatStickerValue(bms)
+		if v == "" || current[song] == v {
+			continue
+		}
+		if err := s.st.StickerSet(song, sn, v); err != nil {
+			return eris.Wrap(err, song)
+		}
+	}
+	for song := range current {
+		if FormatStickerValue(bs[song]) != "" {
+			continue
+		}
+		if err := s.st.StickerDelete(song, sn); err != nil {
+			return eris.Wrap(err, song)
+		}
+	}
+	fp, err := s.fingerprint(name)
+	if err != nil {
+		return err
+	}
+	s.record(name, fp)
+	return nil
+}
+
+// Collections lists the collections found in the sticker names.
+func (s *StickerStore) Collections() ([]string, error) {
+	names, err := s.st.StickerNames()
+	if err != nil {
+		return nil, eris.Wrap(err, "collections")
+	}
+	cols := make([]string, 0)
+	for _, n := range names {
+		switch {
+		case n == StickerName:
+			cols = append(cols, DefaultCollection)
+		case strings.HasPrefix(n, StickerName+":"):
+			cols = append(cols, strings.TrimPrefix(n, StickerName+":"))
+		}
+	}
+	sort.Strings(cols)
+	return cols, nil
+}
+
+func (s *StickerStore) fingerprint(name string) (string, error) {
+	values, err := s.st.StickerFind("", stickerName(name))
+	if err != nil {
+		return "", eris.Wrap(err, "fingerprint")
+	}
+	songs := make([]string, 0, len(values))
+	for song := range values {
+		songs = append(songs, song)
+	}
+	sort.Strings(songs)
+	h := sha1.New()
+	for _, song := range songs {
+		fmt.Fprintf(h, "%s\n%s\n", song, values[song])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Watch polls the stickers of the collection for changes.
+func (s *StickerStore) Watch(name string, fn func()) (func(), error) {
+	return s.poll(name, func() (string, error) { return s.fingerprint(name) }, fn)
+}
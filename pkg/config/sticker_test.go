@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStickers keeps stickers in memory, by song.
+type fakeStickers map[string]string
+
+func (f fakeStickers) StickerSet(uri, name, value string) error {
+	f[uri] = value
+	return nil
+}
+
+func (f fakeStickers) StickerDelete(uri, name string) error {
+	delete(f, uri)
+	return nil
+}
+
+func (f fakeStickers) StickerNames() ([]string, error) {
+	return []string{"rating", StickerName, StickerName + ":live"}, nil
+}
+
+func (f fakeStickers) StickerFind(dir, name string) (map[string]string, error) {
+	res := make(map[string]string)
+	for k, v := range f {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func TestStickerValue(t *testing.T) {
+	assert := assert.New(t)
+
+	bms := []types.Bookmark{
+		{Start: "01:00", End: "01:30", Rating: 4},
+		{Start: "02:00", End: "02:30"},
+		{Start: "03:00"},
+	}
+	v := FormatStickerValue(bms)
+	assert.Equal("01:00-01:30 rating=4;02:00-02:30", v)
+	got, err := ParseStickerValue(v)
+	assert.NoError(err)
+	assert.Equal(bms[:2], got)
+
+	_, err = ParseStickerValue("01:00-01:30;nope")
+	assert.ErrorIs(err, ErrMissingRanges)
+}
+
+func TestStickerStore(t *testing.T) {
+	assert := assert.New(t)
+
+	st := fakeStickers{
+		"old.mp3": "00:10-00:20",
+		"a.mp3":   "01:00-01:30",
+	}
+	store := NewStickerStore(st)
+	bs, order, err := store.Load(DefaultCollection)
+	assert.NoError(err)
+	assert.Equal([]string{"a.mp3", "old.mp3"}, order)
+	assert.Equal(types.BookmarkSet{
+		"old.mp3": {{Start: "00:10", End: "00:20"}},
+		"a.mp3":   {{Start: "01:00", End: "01:30"}},
+	}, bs)
+
+	delete(bs, "old.mp3")
+	bs["b.mp3"] = []types.Bookmark{{Start: "02:00", End: "02:10"}}
+	assert.NoError(store.Save(DefaultCollection, bs, nil))
+	assert.Equal(fakeStickers{
+		"a.mp3": "01:00-01:30",
+		"b.mp3": "02:00-02:10",
+	}, st)
+}
+
+func TestStickerStore_Collections(t *testing.T) {
+	assert := assert.New(t)
+
+	cols, err := NewStickerStore(fakeStickers{}).Collections()
+	assert.NoError(err)
+	assert.Equal([]string{DefaultCollection, "live"}, cols)
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// DefaultCollection is the name of the collection used when none is given,
+// for stores supporting it.
+const DefaultCollection = "default"
+
+// Store persists named collections of bookmarks.
+type Store interface {
+	// Load reads a collection. Songs are also returned in their stored order.
+	Load(name string) (types.BookmarkSet, []string, error)
+	// Save writes a collection, replacing its previous content.
+	Save(name string, bs types.BookmarkSet, order []string) error
+	// Collections lists the names of the stored collections.
+	Collections() ([]string, error)
+	// Watch calls fn whenever the collection is changed by someone else,
+	// until the returned stop function is called.
+	Watch(name string, fn func()) (stop func(), err error)
+}
+
+// Revision is a saved version of a collection.
+type Revision struct {
+	ID      int64
+	Created time.Time
+	Songs   int
+	Ranges  int
+}
+
+// Historian is implemented by stores keeping previous versions of the
+// collections.
+type Historian interface {
+	// History lists the revisions of a collection, latest first.
+	History(name string) ([]Revision, error)
+	// LoadRevision reads a previous version of a collection.
+	LoadRevision(name string, id int64) (types.BookmarkSet, []string, error)
+}
+
+// Querier is implemented by stores able to search songs across collections.
+type Querier interface {
+	// Query returns the songs whose name contains pattern, by collection.
+	Query(pattern string) (map[string][]string, error)
+}
+
+// pollInterval is how often a watched collection is checked for changes.
+var pollInterval = 2 * time.Second
+
+// saves records the fingerprint of the collections saved by a store, so that
+// watching does not report its own changes.
+type saves struct {
+	mu sync.Mutex
+	fp map[string]string
+}
+
+func (s *saves) record(name, fp string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fp == nil {
+		s.fp = make(map[string]string)
+	}
+	s.fp[name] = fp
+}
+
+func (s *saves) own(name, fp string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fp[name] == fp
+}
+
+// poll calls fn when the fingerprint of collection name changes, unless the
+// change was saved by the store itself. Polling ends when the returned stop
+// function is called.
+func (s *saves) poll(name string, check func() (string, error), fn func()) (func(), error) {
+	last, err := check()
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(pollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				fp, err := check()
+				if err != nil || fp == last {
+					continue
+				}
+				last = fp
+				if !s.own(name, fp) {
+					fn()
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+// DefaultDatabasePath returns the default location of the SQLite database of
+// bookmarks, following the XDG base directory specification.
+func DefaultDatabasePath() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", eris.Wrap(err, "database path")
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "bmp", "bookmarks.db"), nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var storeTestSet = types.BookmarkSet{
+	"b.mp3": {{Start: "01:00", End: "01:30", Rating: 4}},
+	"a.mp3": {{Start: "00:10", End: "00:20", FadeIn: 1.5}, {Start: "02:00", End: "02:10"}},
+}
+
+func TestFileStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	st := NewFileStore(dir)
+	assert.NoError(st.Save("best.txt", storeTestSet, []string{"b.mp3", "a.mp3"}))
+	bs, order, err := st.Load("best.txt")
+	assert.NoError(err)
+	assert.Equal(storeTestSet, bs)
+	assert.Equal([]string{"b.mp3", "a.mp3"}, order)
+
+	// Absolute names are not relative to the store directory.
+	bs, _, err = NewFileStore("/nowhere").Load(filepath.Join(dir, "best.txt"))
+	assert.NoError(err)
+	assert.Equal(storeTestSet, bs)
+
+	assert.NoError(os.WriteFile(filepath.Join(dir, ".hidden"), nil, 0644))
+	assert.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	cols, err := st.Collections()
+	assert.NoError(err)
+	assert.Equal([]string{"best.txt"}, cols)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	assert := assert.New(t)
+
+	st, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "bmp.db"))
+	if !assert.NoError(err) {
+		return
+	}
+	defer st.Close()
+
+	_, _, err = st.Load(DefaultCollection)
+	assert.Error(err)
+
+	assert.NoError(st.Save(DefaultCollection, storeTestSet, []string{"b.mp3", "a.mp3"}))
+	bs, order, err := st.Load(DefaultCollection)
+	assert.NoError(err)
+	assert.Equal(storeTestSet, bs)
+	assert.Equal([]string{"b.mp3", "a.mp3"}, order)
+
+	// Second revision, with one song less.
+	assert.NoError(st.Save(DefaultCollection, types.BookmarkSet{"a.mp3": storeTestSet["a.mp3"]}, nil))
+	assert.NoError(st.Save("live", types.BookmarkSet{"live/b.mp3": storeTestSet["b.mp3"]}, nil))
+
+	cols, err := st.Collections()
+	assert.NoError(err)
+	assert.Equal([]string{DefaultCollection, "live"}, cols)
+
+	revs, err := st.History(DefaultCollection)
+	assert.NoError(err)
+	if assert.Len(revs, 2) {
+		assert.Equal(1, revs[0].Songs)
+		assert.Equal(2, revs[1].Songs)
+		assert.Equal(3, revs[1].Ranges)
+		assert.WithinDuration(time.Now(), revs[0].Created, time.Minute)
+		bs, _, err := st.LoadRevision(DefaultCollection, revs[1].ID)
+		assert.NoError(err)
+		assert.Equal(storeTestSet, bs)
+	}
+	_, _, err = st.LoadRevision("live", revs[0].ID)
+	assert.Error(err)
+
+	res, err := st.Query("b.mp3")
+	assert.NoError(err)
+	// The default collection no longer has b.mp3 in its last revision.
+	assert.Equal(map[string][]string{"live": {"live/b.mp3"}}, res)
+}
+
+func TestStore_Watch(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = 50 * time.Millisecond
+	defer func(d time.Duration) { watchSettle = d }(watchSettle)
+	watchSettle = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	st := NewFileStore(dir)
+	assert.NoError(st.Save("best.txt", storeTestSet, nil))
+	changed := make(chan bool, 1)
+	stop, err := st.Watch("best.txt", func() { changed <- true })
+	if !assert.NoError(err) {
+		return
+	}
+	defer stop()
+
+	// Own saves are not reported.
+	assert.NoError(st.Save("best.txt", types.BookmarkSet{"a.mp3": storeTestSet["a.mp3"]}, nil))
+	select {
+	case <-changed:
+		assert.Fail("own save reported")
+	case <-time.After(pollInterval + pollInterval/2):
+	}
+
+	assert.NoError(os.WriteFile(filepath.Join(dir, "best.txt"), []byte("song: c.mp3\n00:01-00:02\n"), 0644))
+	select {
+	case <-changed:
+	case <-time.After(2 * pollInterval):
+		assert.Fail("external change not reported")
+	}
+
+	// Replaced by renaming another file, as done by many editors.
+	tmp := filepath.Join(dir, ".best.txt.swp")
+	assert.NoError(os.WriteFile(tmp, []byte("song: d.mp3\n00:01-00:02\n"), 0644))
+	assert.NoError(os.Rename(tmp, filepath.Join(dir, "best.txt")))
+	select {
+	case <-changed:
+	case <-time.After(2 * pollInterval):
+		assert.Fail("replaced file not reported")
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+var tagRE = regexp.MustCompile(`([a-z_]+)=("(?:[^"\\]|\\.)*")`)
+
+// FormatTags returns the tags of a song as written on the tags: line of a
+// bookmarks file, e.g. artist="Metallica" title="Enter Sandman" duration="331".
+// Empty tags are omitted.
+func FormatTags(t types.SongTags) string {
+	pairs := []struct{ key, value string }{
+		{"artist", t.Artist},
+		{"album", t.Album},
+		{"title", t.Title},
+		{"track", t.Track},
+		{"duration", ""},
+		{"mb_trackid", t.MBTrackID},
+		{"mb_albumid", t.MBAlbumID},
+	}
+	if t.Duration > 0 {
+		pairs[4].value = strconv.Itoa(t.Duration)
+	}
+	fields := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		if p.value != "" {
+			fields = append(fields, fmt.Sprintf("%s=%s", p.key, strconv.Quote(p.value)))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// ParseTags reads song tags written by FormatTags. Unknown keys are ignored.
+func ParseTags(s string) (types.SongTags, error) {
+	var t types.SongTags
+	for _, m := range tagRE.FindAllStringSubmatch(s, -1) {
+		v, err := strconv.Unquote(m[2])
+		if err != nil {
+			return t, eris.Wrap(ErrBadTags, m[0])
+		}
+		switch m[1] {
+		case "artist":
+			t.Artist = v
+		case "album":
+			t.Album = v
+		case "title":
+			t.Title = v
+		case "track":
+			t.Track = v
+		case "duration":
+			t.Duration, err = strconv.Atoi(v)
+			if err != nil {
+				return t, eris.Wrap(ErrBadTags, m[0])
+			}
+		case "mb_trackid":
+			t.MBTrackID = v
+		case "mb_albumid":
+			t.MBAlbumID = v
+		}
+	}
+	return t, nil
+}
+
+// songTags returns the tags recorded with the bookmarks of a song.
+func songTags(bms []types.Bookmark) types.SongTags {
+	for _, bm := range bms {
+		if !bm.Tags.IsZero() {
+			return bm.Tags
+		}
+	}
+	return types.SongTags{}
+}
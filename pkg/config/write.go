@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/rotisserie/eris"
+)
+
+// SongOrder returns all songs of the set, following order first, then any
+// remaining song sorted by name.
+func SongOrder(bs types.BookmarkSet, order []string) []string {
+	songs := make([]string, 0, len(bs))
+	seen := make(map[string]bool)
+	for _, song := range order {
+		if _, ok := bs[song]; ok && !seen[song] {
+			songs = append(songs, song)
+			seen[song] = true
+		}
+	}
+	rest := make([]string, 0)
+	for song := range bs {
+		if !seen[song] {
+			rest = append(rest, song)
+		}
+	}
+	sort.Strings(rest)
+	return append(songs, rest...)
+}
+
+// WriteBookmarkFile writes the bookmark set in the bookmarks file format, songs
+// following order first. Returns the number of bytes written.
+func WriteBookmarkFile(w io.Writer, bs types.BookmarkSet, order []string) (int, error) {
+	var b strings.Builder
+	for _, song := range SongOrder(bs, order) {
+		fmt.Fprintf(&b, "song: %s\n", song)
+		if t := songTags(bs[song]); !t.IsZero() {
+			fmt.Fprintf(&b, "tags: %s\n", FormatTags(t))
+		}
+		for _, bm := range bs[song] {
+			fmt.Fprintf(&b, "%s\n", FormatRange(bm))
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return n, eris.Wrap(err, "write bookmarks")
+}
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/matm/bmp/pkg/types"
@@ -16,18 +19,42 @@ import (
 // Client to MPD.
 // Doc at https://mpd.readthedocs.io/en/latest/protocol.html.
 type Client struct {
+	// Serializes commands sent by concurrent goroutines.
+	mu   sync.Mutex
 	conn net.Conn
 	dial dialer
 	host string
 	port int
+	// Partition selected, restored on reconnection. Default partition if
+	// empty.
+	partition string
+	password  string
 }
 
 type response map[string]string
 
+// field is a key: value line of a response. Kept in order since list
+// responses repeat keys.
+type field struct {
+	key, value string
+}
+
 type commander interface {
 	Exec(cmd string) (response, error)
 }
 
+// ErrNoSticker is returned when a song has no sticker with the requested name.
+var ErrNoSticker = errors.New("no such sticker")
+
+// ackNoExist is the MPD error code of a missing object.
+const ackNoExist = "[50@"
+
+// quote returns s as a MPD command argument.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
 const (
 	// ReplyOK is an OK reply from mpd. The command went fine.
 	ReplyOK = "OK"
@@ -36,8 +63,80 @@ const (
 )
 
 func (d *Client) exec(cmd string) (response, error) {
+	fields, err := d.execFields(cmd)
+	if err != nil {
+		return nil, err
+	}
+	resp := make(response)
+	for _, f := range fields {
+		resp[f.key] = f.value
+	}
+	return resp, nil
+}
+
+// records splits a list response into records, each one starting with the
+// first key.
+func records(fields []field, first string) []response {
+	res := make([]response, 0)
+	for _, f := range fields {
+		if f.key == first || len(res) == 0 {
+			res = append(res, make(response))
+		}
+		res[len(res)-1][f.key] = f.value
+	}
+	return res
+}
+
+// connect dials MPD, authenticates and selects the client's partition, if
+// any.
+func (d *Client) connect() (net.Conn, error) {
+	conn, err := d.dial.Dial(d.host, d.port)
+	if err != nil {
+		return nil, err
+	}
+	setup := make([]string, 0)
+	if d.password != "" {
+		setup = append(setup, "password "+quote(d.password))
+	}
+	if d.partition != "" {
+		setup = append(setup, "partition "+quote(d.partition))
+	}
+	for _, cmd := range setup {
+		if err := handshake(conn, cmd); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// handshake sends a command expecting an empty reply on a new connection.
+func handshake(conn net.Conn, cmd string) error {
+	name := strings.Fields(cmd)[0]
+	if _, err := conn.Write([]byte(cmd + "\n")); err != nil {
+		return eris.Wrap(err, name)
+	}
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		line := sc.Text()
+		if line == ReplyOK {
+			return nil
+		}
+		if strings.HasPrefix(line, ReplyACK) {
+			return eris.New(line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return eris.Wrap(err, name)
+	}
+	return eris.Wrap(io.ErrUnexpectedEOF, name)
+}
+
+func (d *Client) execFields(cmd string) ([]field, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.conn == nil {
-		conn, err := d.dial.Dial(d.host, d.port)
+		conn, err := d.connect()
 		if err != nil {
 			return nil, eris.Wrap(err, "dial")
 		}
@@ -45,7 +144,7 @@ func (d *Client) exec(cmd string) (response, error) {
 	}
 	retry := func(conn net.Conn) error {
 		conn.Close()
-		conn, err := d.dial.Dial(d.host, d.port)
+		conn, err := d.connect()
 		if err != nil {
 			return eris.Wrap(err, "(re)dial")
 		}
@@ -69,8 +168,9 @@ func (d *Client) exec(cmd string) (response, error) {
 		}
 	}
 
-	resp := make(response)
+	resp := make([]field, 0)
 read:
+	resp = resp[:0]
 	sc := bufio.NewScanner(d.conn)
 	emptyReply := true
 	for sc.Scan() {
@@ -82,10 +182,10 @@ read:
 		if strings.HasPrefix(line, ReplyACK) {
 			return nil, eris.New(line)
 		}
-		sp := strings.Split(line, ": ")
+		sp := strings.SplitN(line, ": ", 2)
 		if len(sp) == 2 {
 			// This is a key: value response line.
-			resp[sp[0]] = sp[1]
+			resp = append(resp, field{sp[0], sp[1]})
 		}
 	}
 	err = sc.Err()
@@ -137,10 +237,165 @@ func (d *Client) CurrentSong() (*types.Song, error) {
 		Time:         ti,
 		Title:        res["Title"],
 		Track:        res["Track"],
+		MBTrackID:    res["MUSICBRAINZ_TRACKID"],
+		MBAlbumID:    res["MUSICBRAINZ_ALBUMID"],
 	}
 	return s, err
 }
 
+// songFromRecord returns the song described by a record of a song list
+// response. Missing or invalid numeric values are left to zero.
+func songFromRecord(res response) types.Song {
+	dur, _ := strconv.ParseFloat(res["duration"], 64)
+	pos, _ := strconv.ParseInt(res["Pos"], 10, 64)
+	ti, _ := strconv.ParseInt(res["Time"], 10, 64)
+	return types.Song{
+		ID:           res["Id"],
+		Album:        res["Album"],
+		Artist:       res["Artist"],
+		Date:         res["Date"],
+		Duration:     dur,
+		File:         res["file"],
+		Genre:        res["Genre"],
+		LastModified: res["Last-Modified"],
+		Pos:          pos,
+		Time:         ti,
+		Title:        res["Title"],
+		Track:        res["Track"],
+		MBTrackID:    res["MUSICBRAINZ_TRACKID"],
+		MBAlbumID:    res["MUSICBRAINZ_ALBUMID"],
+	}
+}
+
+// songs returns the songs of a song list response.
+func songs(fields []field) []types.Song {
+	res := make([]types.Song, 0)
+	for _, rec := range records(fields, "file") {
+		if rec["file"] != "" {
+			res = append(res, songFromRecord(rec))
+		}
+	}
+	return res
+}
+
+// Filter returns a MPD filter expression comparing a tag to a value, e.g.
+// Filter("artist", "==", "Metallica"). See
+// https://mpd.readthedocs.io/en/latest/protocol.html#filters.
+func Filter(tag, op, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return fmt.Sprintf("(%s %s '%s')", tag, op, r.Replace(value))
+}
+
+// And returns a filter expression matching all of the given expressions.
+func And(exprs ...string) string {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	return "(" + strings.Join(exprs, " AND ") + ")"
+}
+
+// tagsFilter returns an expression matching all tag values with op.
+func tagsFilter(tags map[string]string, op string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	exprs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		exprs = append(exprs, Filter(k, op, tags[k]))
+	}
+	return And(exprs...)
+}
+
+// Find returns the songs of the database matching a filter expression
+// exactly. Tag comparisons are case sensitive.
+func (d *Client) Find(filter string) ([]types.Song, error) {
+	fields, err := d.execFields("find " + quote(filter))
+	if err != nil {
+		return nil, eris.Wrap(err, "find")
+	}
+	return songs(fields), nil
+}
+
+// Search is like Find but tag comparisons are case insensitive.
+func (d *Client) Search(filter string) ([]types.Song, error) {
+	fields, err := d.execFields("search " + quote(filter))
+	if err != nil {
+		return nil, eris.Wrap(err, "search")
+	}
+	return songs(fields), nil
+}
+
+// FindSongs returns the songs having exactly all the given tag values, by tag
+// name.
+func (d *Client) FindSongs(tags map[string]string) ([]types.Song, error) {
+	return d.Find(tagsFilter(tags, "=="))
+}
+
+// SearchSongs returns the songs whose tags contain all the given values, case
+// insensitive.
+func (d *Client) SearchSongs(tags map[string]string) ([]types.Song, error) {
+	return d.Search(tagsFilter(tags, "contains"))
+}
+
+// LsInfo lists the content of a directory of the music database, relative to
+// the music directory. Use an empty uri for the root directory.
+func (d *Client) LsInfo(uri string) ([]types.Entry, error) {
+	fields, err := d.execFields("lsinfo " + quote(uri))
+	if err != nil {
+		return nil, eris.Wrap(err, "lsinfo")
+	}
+	entries := make([]types.Entry, 0)
+	var rec response
+	flush := func() {
+		if rec == nil {
+			return
+		}
+		switch {
+		case rec["file"] != "":
+			s := songFromRecord(rec)
+			entries = append(entries, types.Entry{Path: s.File, Song: &s})
+		case rec["directory"] != "":
+			entries = append(entries, types.Entry{Path: rec["directory"], Directory: true})
+		case rec["playlist"] != "":
+			entries = append(entries, types.Entry{Path: rec["playlist"]})
+		}
+	}
+	for _, f := range fields {
+		switch f.key {
+		case "file", "directory", "playlist":
+			flush()
+			rec = make(response)
+		}
+		if rec != nil {
+			rec[f.key] = f.value
+		}
+	}
+	flush()
+	return entries, nil
+}
+
+// List returns the unique values of a tag, e.g. all artists, among the songs
+// matching a filter expression. Use an empty filter for the whole database.
+func (d *Client) List(tag, filter string) ([]string, error) {
+	cmd := "list " + tag
+	if filter != "" {
+		cmd += " " + quote(filter)
+	}
+	fields, err := d.execFields(cmd)
+	if err != nil {
+		return nil, eris.Wrap(err, "list")
+	}
+	values := make([]string, 0)
+	for _, f := range fields {
+		if strings.EqualFold(f.key, tag) {
+			values = append(values, f.value)
+		}
+	}
+	return values, nil
+}
+
 // Status get shorter but useful information about the current song, like
 // the song ID and the time elapsed in the song.
 func (d *Client) Status() (*types.Status, error) {
@@ -160,9 +415,13 @@ func (d *Client) Status() (*types.Status, error) {
 	if err != nil {
 		return nil, eris.Wrap(err, "status: elapsed")
 	}
-	vol, err := strconv.ParseInt(res["volume"], 10, 64)
-	if err != nil {
-		return nil, eris.Wrap(err, "status: volume")
+	// No volume reported if MPD has no mixer.
+	vol := int64(-1)
+	if res["volume"] != "" {
+		vol, err = strconv.ParseInt(res["volume"], 10, 64)
+		if err != nil {
+			return nil, eris.Wrap(err, "status: volume")
+		}
 	}
 	s := &types.Status{
 		Duration: dur,
@@ -188,22 +447,225 @@ func (d *Client) Toggle() error {
 	return eris.Wrap(err, "toggle")
 }
 
+// Pause pauses or resumes playback.
+func (d *Client) Pause(pause bool) error {
+	state := 0
+	if pause {
+		state = 1
+	}
+	_, err := d.exec(fmt.Sprintf("pause %d", state))
+	return eris.Wrap(err, "pause")
+}
+
 // SeekOffset seeks to the time relative to the current playing position.
-func (d *Client) SeekOffset(offset int) error {
+func (d *Client) SeekOffset(offset float64) error {
 	sig := "+"
 	if offset < 0 {
 		sig = ""
 	}
-	_, err := d.exec(fmt.Sprintf("seekcur %s%d", sig, offset))
+	_, err := d.exec("seekcur " + sig + strconv.FormatFloat(offset, 'f', -1, 64))
 	return err
 }
 
 // SeekTo seeks to the position TIME in seconds within the current song.
-func (d *Client) SeekTo(seconds int) error {
-	_, err := d.exec(fmt.Sprintf("seekcur %d", seconds))
+func (d *Client) SeekTo(seconds float64) error {
+	_, err := d.exec("seekcur " + strconv.FormatFloat(seconds, 'f', -1, 64))
 	return eris.Wrap(err, "seekcur")
 }
 
+// SeekID begins playing song ID at the position TIME in seconds.
+func (d *Client) SeekID(ID int64, seconds float64) error {
+	_, err := d.exec(fmt.Sprintf("seekid %d %s", ID, strconv.FormatFloat(seconds, 'f', -1, 64)))
+	return eris.Wrap(err, "seekid")
+}
+
+// SetVolume sets the volume, from 0 to 100.
+func (d *Client) SetVolume(vol int) error {
+	_, err := d.exec(fmt.Sprintf("setvol %d", vol))
+	return eris.Wrap(err, "setvol")
+}
+
+// Volume returns the volume, from 0 to 100, or -1 if MPD has no mixer.
+func (d *Client) Volume() (int, error) {
+	res, err := d.exec("status")
+	if err != nil {
+		return -1, eris.Wrap(err, "status")
+	}
+	if res["volume"] == "" {
+		return -1, nil
+	}
+	vol, err := strconv.Atoi(res["volume"])
+	return vol, eris.Wrap(err, "status: volume")
+}
+
+// ChangeVolume changes the volume by delta, which may be negative.
+func (d *Client) ChangeVolume(delta int) error {
+	_, err := d.exec(fmt.Sprintf("volume %+d", delta))
+	return eris.Wrap(err, "volume")
+}
+
+// EnableOutput turns an output on.
+func (d *Client) EnableOutput(id int) error {
+	_, err := d.exec(fmt.Sprintf("enableoutput %d", id))
+	return eris.Wrap(err, "enableoutput")
+}
+
+// DisableOutput turns an output off.
+func (d *Client) DisableOutput(id int) error {
+	_, err := d.exec(fmt.Sprintf("disableoutput %d", id))
+	return eris.Wrap(err, "disableoutput")
+}
+
+// ToggleOutput turns an output on or off, depending on its current state.
+func (d *Client) ToggleOutput(id int) error {
+	_, err := d.exec(fmt.Sprintf("toggleoutput %d", id))
+	return eris.Wrap(err, "toggleoutput")
+}
+
+// Outputs lists all audio outputs.
+func (d *Client) Outputs() ([]types.Output, error) {
+	fields, err := d.execFields("outputs")
+	if err != nil {
+		return nil, eris.Wrap(err, "outputs")
+	}
+	outs := make([]types.Output, 0)
+	for _, f := range fields {
+		if f.key == "outputid" {
+			id, err := strconv.Atoi(f.value)
+			if err != nil {
+				return nil, eris.Wrap(err, "outputs: id")
+			}
+			outs = append(outs, types.Output{ID: id, Attributes: make(map[string]string)})
+			continue
+		}
+		if len(outs) == 0 {
+			continue
+		}
+		out := &outs[len(outs)-1]
+		switch f.key {
+		case "outputname":
+			out.Name = f.value
+		case "plugin":
+			out.Plugin = f.value
+		case "outputenabled":
+			out.Enabled = f.value == "1"
+		case "attribute":
+			kv := strings.SplitN(f.value, "=", 2)
+			if len(kv) == 2 {
+				out.Attributes[kv[0]] = kv[1]
+			}
+		}
+	}
+	return outs, nil
+}
+
+// SetOutputAttribute sets a runtime attribute of an output. Supported
+// attributes depend on the output plugin.
+func (d *Client) SetOutputAttribute(id int, name, value string) error {
+	_, err := d.exec(fmt.Sprintf("outputset %d %s %s", id, quote(name), quote(value)))
+	return eris.Wrap(err, "outputset")
+}
+
+// Update updates the music database for the given path, relative to the music
+// directory. The update runs in the background, see Updating.
+func (d *Client) Update(uri string) error {
+	_, err := d.exec("update " + quote(uri))
+	return eris.Wrap(err, "update")
+}
+
+// Updating returns true while a music database update is running.
+func (d *Client) Updating() (bool, error) {
+	res, err := d.exec("status")
+	if err != nil {
+		return false, eris.Wrap(err, "status")
+	}
+	_, ok := res["updating_db"]
+	return ok, nil
+}
+
+// StickerGet returns the value of a song's sticker. ErrNoSticker is returned
+// if the sticker does not exist.
+func (d *Client) StickerGet(uri, name string) (string, error) {
+	res, err := d.exec(fmt.Sprintf("sticker get song %s %s", quote(uri), quote(name)))
+	if err != nil {
+		if strings.Contains(err.Error(), ackNoExist) {
+			return "", ErrNoSticker
+		}
+		return "", eris.Wrap(err, "sticker get")
+	}
+	kv := strings.SplitN(res["sticker"], "=", 2)
+	if len(kv) != 2 {
+		return "", ErrNoSticker
+	}
+	return kv[1], nil
+}
+
+// StickerSet sets the value of a song's sticker, replacing any previous value.
+func (d *Client) StickerSet(uri, name, value string) error {
+	_, err := d.exec(fmt.Sprintf("sticker set song %s %s %s", quote(uri), quote(name), quote(value)))
+	return eris.Wrap(err, "sticker set")
+}
+
+// StickerDelete deletes a song's sticker. Deleting a missing sticker is not
+// an error.
+func (d *Client) StickerDelete(uri, name string) error {
+	_, err := d.exec(fmt.Sprintf("sticker delete song %s %s", quote(uri), quote(name)))
+	if err != nil && strings.Contains(err.Error(), ackNoExist) {
+		return nil
+	}
+	return eris.Wrap(err, "sticker delete")
+}
+
+// StickerList returns all stickers of a song, by name.
+func (d *Client) StickerList(uri string) (map[string]string, error) {
+	fields, err := d.execFields(fmt.Sprintf("sticker list song %s", quote(uri)))
+	if err != nil {
+		return nil, eris.Wrap(err, "sticker list")
+	}
+	res := make(map[string]string)
+	for _, f := range fields {
+		kv := strings.SplitN(f.value, "=", 2)
+		if f.key == "sticker" && len(kv) == 2 {
+			res[kv[0]] = kv[1]
+		}
+	}
+	return res, nil
+}
+
+// StickerFind searches the songs below dir having a sticker with the given
+// name. It returns the sticker value by song. Use an empty dir to search the
+// whole database.
+func (d *Client) StickerFind(dir, name string) (map[string]string, error) {
+	fields, err := d.execFields(fmt.Sprintf("sticker find song %s %s", quote(dir), quote(name)))
+	if err != nil {
+		return nil, eris.Wrap(err, "sticker find")
+	}
+	res := make(map[string]string)
+	for _, rec := range records(fields, "file") {
+		kv := strings.SplitN(rec["sticker"], "=", 2)
+		if rec["file"] != "" && len(kv) == 2 {
+			res[rec["file"]] = kv[1]
+		}
+	}
+	return res, nil
+}
+
+// StickerNames lists the names of all stickers of the database. Requires
+// MPD 0.24 or later.
+func (d *Client) StickerNames() ([]string, error) {
+	fields, err := d.execFields("stickernames")
+	if err != nil {
+		return nil, eris.Wrap(err, "stickernames")
+	}
+	names := make([]string, 0)
+	for _, f := range fields {
+		if f.key == "name" {
+			names = append(names, f.value)
+		}
+	}
+	return names, nil
+}
+
 // Stop stops playing.
 func (d *Client) Stop() error {
 	_, err := d.exec("stop")
@@ -220,12 +682,166 @@ func (d *Client) AddToQueue(song string) (int64, error) {
 	return id, eris.Wrap(err, "addid")
 }
 
+// QueueID returns the ID of the first queue entry of a song, -1 if the song
+// is not queued.
+func (d *Client) QueueID(song string) (int64, error) {
+	fields, err := d.execFields("playlistfind " + quote(Filter("file", "==", song)))
+	if err != nil {
+		return -1, eris.Wrap(err, "playlistfind")
+	}
+	found := songs(fields)
+	if len(found) == 0 {
+		return -1, nil
+	}
+	id, err := strconv.ParseInt(found[0].ID, 10, 64)
+	return id, eris.Wrap(err, "id")
+}
+
 // PlaySongID Begins playing the playlist at song ID.
 func (d *Client) PlaySongID(ID int64) error {
 	_, err := d.exec(fmt.Sprintf("playid %d", ID))
 	return eris.Wrap(err, "playid")
 }
 
+// Play begins playing the queue at song position pos.
+func (d *Client) Play(pos int) error {
+	_, err := d.exec(fmt.Sprintf("play %d", pos))
+	return eris.Wrap(err, "play")
+}
+
+// Queue returns the songs of the queue, in order.
+func (d *Client) Queue() ([]types.Song, error) {
+	fields, err := d.execFields("playlistinfo")
+	if err != nil {
+		return nil, eris.Wrap(err, "playlistinfo")
+	}
+	return songs(fields), nil
+}
+
+// Clear removes all songs from the queue.
+func (d *Client) Clear() error {
+	_, err := d.exec("clear")
+	return eris.Wrap(err, "clear")
+}
+
+// Delete removes the song at position pos from the queue.
+func (d *Client) Delete(pos int) error {
+	_, err := d.exec(fmt.Sprintf("delete %d", pos))
+	return eris.Wrap(err, "delete")
+}
+
+// DeleteID removes the song with the given ID from the queue.
+func (d *Client) DeleteID(ID int64) error {
+	_, err := d.exec(fmt.Sprintf("deleteid %d", ID))
+	return eris.Wrap(err, "deleteid")
+}
+
+// Move moves the song at position from to position to in the queue.
+func (d *Client) Move(from, to int) error {
+	_, err := d.exec(fmt.Sprintf("move %d %d", from, to))
+	return eris.Wrap(err, "move")
+}
+
+// Playlists returns the names of the stored playlists.
+func (d *Client) Playlists() ([]string, error) {
+	fields, err := d.execFields("listplaylists")
+	if err != nil {
+		return nil, eris.Wrap(err, "listplaylists")
+	}
+	names := make([]string, 0)
+	for _, f := range fields {
+		if f.key == "playlist" {
+			names = append(names, f.value)
+		}
+	}
+	return names, nil
+}
+
+// PlaylistSongs returns the songs of a stored playlist.
+func (d *Client) PlaylistSongs(name string) ([]types.Song, error) {
+	fields, err := d.execFields("listplaylistinfo " + quote(name))
+	if err != nil {
+		return nil, eris.Wrap(err, "listplaylistinfo")
+	}
+	return songs(fields), nil
+}
+
+// SavePlaylist saves the queue to a new stored playlist. Fails if the
+// playlist already exists.
+func (d *Client) SavePlaylist(name string) error {
+	_, err := d.exec("save " + quote(name))
+	return eris.Wrap(err, "save")
+}
+
+// LoadPlaylist appends the songs of a stored playlist to the queue.
+func (d *Client) LoadPlaylist(name string) error {
+	_, err := d.exec("load " + quote(name))
+	return eris.Wrap(err, "load")
+}
+
+// RemovePlaylist deletes a stored playlist. Removing a missing playlist is
+// not an error.
+func (d *Client) RemovePlaylist(name string) error {
+	_, err := d.exec("rm " + quote(name))
+	if err != nil && strings.Contains(err.Error(), ackNoExist) {
+		return nil
+	}
+	return eris.Wrap(err, "rm")
+}
+
+// Partitions returns the names of the partitions of the MPD server.
+func (d *Client) Partitions() ([]string, error) {
+	fields, err := d.execFields("listpartitions")
+	if err != nil {
+		return nil, eris.Wrap(err, "listpartitions")
+	}
+	names := make([]string, 0)
+	for _, f := range fields {
+		if f.key == "partition" {
+			names = append(names, f.value)
+		}
+	}
+	return names, nil
+}
+
+// NewPartition creates a partition, with its own queue and player state.
+func (d *Client) NewPartition(name string) error {
+	_, err := d.exec("newpartition " + quote(name))
+	return eris.Wrap(err, "newpartition")
+}
+
+// DeletePartition deletes a partition. It must not have any output left.
+func (d *Client) DeletePartition(name string) error {
+	_, err := d.exec("delpartition " + quote(name))
+	return eris.Wrap(err, "delpartition")
+}
+
+// SwitchPartition makes all later commands of the client apply to the given
+// partition, including after a reconnection.
+func (d *Client) SwitchPartition(name string) error {
+	if _, err := d.exec("partition " + quote(name)); err != nil {
+		return eris.Wrap(err, "partition")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.partition = name
+	return nil
+}
+
+// Partition returns the name of the partition selected with SwitchPartition,
+// empty for the default partition.
+func (d *Client) Partition() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.partition
+}
+
+// MoveOutput moves an output, by name, to the partition of the client.
+func (d *Client) MoveOutput(name string) error {
+	_, err := d.exec("moveoutput " + quote(name))
+	return eris.Wrap(err, "moveoutput")
+}
+
 // NewClient creates a new MPD client.
 func NewClient(host string, port int) *Client {
 	return &Client{
@@ -236,6 +852,26 @@ func NewClient(host string, port int) *Client {
 	//return &Client{dial: testDialer}
 }
 
+// SetPassword sets the password sent to MPD on every new connection. Use
+// before the first command.
+func (d *Client) SetPassword(password string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.password = password
+}
+
+// SetServer closes the connection so that later commands are sent to another
+// MPD server. The partition is reset to the default one.
+func (d *Client) SetServer(host string, port int, password string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn != nil {
+		d.conn.Close()
+		d.conn = nil
+	}
+	d.host, d.port, d.password, d.partition = host, port, password, ""
+}
+
 // Close terminates the TCP connection.
 func (d *Client) Close() error {
 	var err error
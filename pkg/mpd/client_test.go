@@ -0,0 +1,327 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/matm/bmp/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// pipeDialer serves canned replies to MPD commands over an in-memory
+// connection.
+type pipeDialer struct {
+	replies map[string]string
+	// Commands received, in order.
+	cmds []string
+}
+
+func (p *pipeDialer) Name() string {
+	return "Pipe dialer"
+}
+
+func (p *pipeDialer) Dial(host string, port int) (net.Conn, error) {
+	client, server := net.Pipe()
+	go p.serve(server)
+	return client, nil
+}
+
+func (p *pipeDialer) serve(conn net.Conn) {
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		cmd := sc.Text()
+		p.cmds = append(p.cmds, cmd)
+		reply, ok := p.replies[cmd]
+		if !ok {
+			fmt.Fprintf(conn, "ACK [5@0] {} unknown command %q\n", cmd)
+			continue
+		}
+		fmt.Fprint(conn, reply+"OK\n")
+	}
+}
+
+func newTestClient(replies map[string]string) (*Client, *pipeDialer) {
+	d := &pipeDialer{replies: replies}
+	return &Client{dial: d}, d
+}
+
+func TestClient_Outputs(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, _ := newTestClient(map[string]string{
+		"outputs": `outputid: 0
+outputname: My ALSA Device
+plugin: alsa
+outputenabled: 1
+attribute: dop=0
+attribute: allowed_formats=
+outputid: 1
+outputname: Stream: HTTP
+plugin: httpd
+outputenabled: 0
+`,
+	})
+	defer mp.Close()
+	outs, err := mp.Outputs()
+	assert.NoError(err)
+	assert.Equal([]types.Output{
+		{ID: 0, Name: "My ALSA Device", Plugin: "alsa", Enabled: true,
+			Attributes: map[string]string{"dop": "0", "allowed_formats": ""}},
+		{ID: 1, Name: "Stream: HTTP", Plugin: "httpd", Enabled: false,
+			Attributes: map[string]string{}},
+	}, outs)
+}
+
+func TestClient_quoting(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		`outputset 0 "dop" "1"`:        "",
+		`update "rock/AC\"DC\\live	2"`: "updating_db: 1\n",
+	})
+	defer mp.Close()
+	assert.NoError(mp.SetOutputAttribute(0, "dop", "1"))
+	assert.NoError(mp.Update("rock/AC\"DC\\live\t2"))
+	assert.Equal([]string{`outputset 0 "dop" "1"`, `update "rock/AC\"DC\\live	2"`}, d.cmds)
+}
+
+func TestClient_error(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, _ := newTestClient(nil)
+	defer mp.Close()
+	err := mp.Ping()
+	assert.Error(err)
+	assert.Contains(err.Error(), "unknown command")
+}
+
+func Test_records(t *testing.T) {
+	assert := assert.New(t)
+
+	fields := []field{
+		{"file", "a.mp3"}, {"Title", "A"},
+		{"file", "b.mp3"},
+	}
+	assert.Equal([]response{
+		{"file": "a.mp3", "Title": "A"},
+		{"file": "b.mp3"},
+	}, records(fields, "file"))
+	assert.Empty(records(nil, "file"))
+}
+
+func TestClient_Stickers(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		`sticker get song "a b.mp3" "bmp"`: "sticker: bmp=01:00-01:30\n",
+		`sticker find song "" "bmp"`: `file: a b.mp3
+sticker: bmp=01:00-01:30
+file: c.mp3
+sticker: bmp=a=b
+`,
+		`sticker set song "say \"hi\".mp3" "bmp" "v"`: "",
+	})
+	defer mp.Close()
+	v, err := mp.StickerGet("a b.mp3", "bmp")
+	assert.NoError(err)
+	assert.Equal("01:00-01:30", v)
+
+	found, err := mp.StickerFind("", "bmp")
+	assert.NoError(err)
+	assert.Equal(map[string]string{"a b.mp3": "01:00-01:30", "c.mp3": "a=b"}, found)
+
+	assert.NoError(mp.StickerSet(`say "hi".mp3`, "bmp", "v"))
+	assert.Equal(`sticker set song "say \"hi\".mp3" "bmp" "v"`, d.cmds[len(d.cmds)-1])
+}
+
+func TestClient_FindSongs(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		`find "((artist == 'Guns N\\' Roses') AND (title == 'Don\\'t Cry'))"`: `file: gnr/dont_cry.mp3
+Artist: Guns N' Roses
+Title: Don't Cry
+duration: 284.5
+file: gnr/live/dont_cry.mp3
+Artist: Guns N' Roses
+Title: Don't Cry
+`,
+	})
+	defer mp.Close()
+	songs, err := mp.FindSongs(map[string]string{"title": "Don't Cry", "artist": "Guns N' Roses"})
+	assert.NoError(err, d.cmds)
+	if assert.Len(songs, 2) {
+		assert.Equal("gnr/dont_cry.mp3", songs[0].File)
+		assert.Equal("Don't Cry", songs[0].Title)
+		assert.Equal("gnr/live/dont_cry.mp3", songs[1].File)
+	}
+}
+
+func TestClient_LsInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, _ := newTestClient(map[string]string{
+		`lsinfo "metal"`: `directory: metal/Metallica
+Last-Modified: 2023-01-02T10:00:00Z
+file: metal/one.mp3
+Artist: Metallica
+Title: One
+duration: 446.1
+playlist: metal/best.m3u
+`,
+		`list album "(artist == 'Metallica')"`: "Album: Black Album\nAlbum: Load\n",
+	})
+	defer mp.Close()
+	entries, err := mp.LsInfo("metal")
+	assert.NoError(err)
+	if assert.Len(entries, 3) {
+		assert.Equal(types.Entry{Path: "metal/Metallica", Directory: true}, entries[0])
+		assert.Equal("metal/one.mp3", entries[1].Path)
+		if assert.NotNil(entries[1].Song) {
+			assert.Equal("One", entries[1].Song.Title)
+			assert.Equal(446.1, entries[1].Song.Duration)
+		}
+		assert.Equal(types.Entry{Path: "metal/best.m3u"}, entries[2])
+	}
+
+	albums, err := mp.List("album", Filter("artist", "==", "Metallica"))
+	assert.NoError(err)
+	assert.Equal([]string{"Black Album", "Load"}, albums)
+}
+
+func TestClient_Queue(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		"playlistinfo": `file: a.mp3
+Pos: 0
+Id: 12
+file: b.mp3
+Title: B
+Pos: 1
+Id: 13
+`,
+		"listplaylists": `playlist: best of
+Last-Modified: 2023-01-02T10:00:00Z
+playlist: bmp
+Last-Modified: 2023-01-03T10:00:00Z
+`,
+		`save "best of"`:                   "",
+		`load "best of"`:                   "",
+		"move 1 0":                         "",
+		`playlistfind "(file == 'b.mp3')"`: "file: b.mp3\nPos: 1\nId: 13\n",
+		`playlistfind "(file == 'c.mp3')"`: "",
+	})
+	defer mp.Close()
+	queue, err := mp.Queue()
+	assert.NoError(err)
+	if assert.Len(queue, 2) {
+		assert.Equal("12", queue[0].ID)
+		assert.Equal(int64(1), queue[1].Pos)
+		assert.Equal("B", queue[1].Title)
+	}
+	names, err := mp.Playlists()
+	assert.NoError(err)
+	assert.Equal([]string{"best of", "bmp"}, names)
+
+	assert.NoError(mp.SavePlaylist("best of"))
+	assert.NoError(mp.LoadPlaylist("best of"))
+	assert.NoError(mp.Move(1, 0))
+	id, err := mp.QueueID("b.mp3")
+	assert.NoError(err)
+	assert.Equal(int64(13), id)
+	id, err = mp.QueueID("c.mp3")
+	assert.NoError(err)
+	assert.Equal(int64(-1), id)
+	assert.Error(mp.Clear())
+	assert.Equal("clear", d.cmds[len(d.cmds)-1])
+}
+
+func TestClient_Partition(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		"listpartitions":       "partition: default\npartition: bmp\n",
+		`partition "bmp"`:      "",
+		`moveoutput "My ALSA"`: "",
+		"ping":                 "",
+	})
+	defer mp.Close()
+	names, err := mp.Partitions()
+	assert.NoError(err)
+	assert.Equal([]string{"default", "bmp"}, names)
+
+	assert.NoError(mp.SwitchPartition("bmp"))
+	assert.Equal("bmp", mp.Partition())
+	assert.NoError(mp.MoveOutput("My ALSA"))
+
+	// The partition is selected again on a new connection.
+	mp.Close()
+	mp.conn = nil
+	assert.NoError(mp.Ping())
+	assert.Equal([]string{`partition "bmp"`, "ping"}, d.cmds[len(d.cmds)-2:])
+}
+
+func TestClient_Volume(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		"status":    "volume: 42\nstate: play\nduration: 100.5\nelapsed: 10.2\nsongid: 3\n",
+		"volume +5": "",
+		"volume -5": "",
+	})
+	defer mp.Close()
+	vol, err := mp.Volume()
+	assert.NoError(err)
+	assert.Equal(42, vol)
+	assert.NoError(mp.ChangeVolume(5))
+	assert.NoError(mp.ChangeVolume(-5))
+	assert.Equal([]string{"status", "volume +5", "volume -5"}, d.cmds)
+
+	// No mixer.
+	mp, _ = newTestClient(map[string]string{
+		"status": "state: play\nduration: 100.5\nelapsed: 10.2\nsongid: 3\n",
+	})
+	defer mp.Close()
+	st, err := mp.Status()
+	assert.NoError(err)
+	assert.Equal(int64(-1), st.Volume)
+	vol, err = mp.Volume()
+	assert.NoError(err)
+	assert.Equal(-1, vol)
+}
+
+func TestClient_Password(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		`password "s3cret"`: "",
+		"ping":              "",
+	})
+	defer mp.Close()
+	mp.SetPassword("s3cret")
+	assert.NoError(mp.Ping())
+	assert.Equal([]string{`password "s3cret"`, "ping"}, d.cmds)
+
+	mp.SetServer("localhost", 6600, "wrong")
+	assert.Error(mp.Ping())
+}
+
+func TestClient_Seek(t *testing.T) {
+	assert := assert.New(t)
+
+	mp, d := newTestClient(map[string]string{
+		"seekcur 62.5": "",
+		"seekcur +30":  "",
+		"seekcur -2.5": "",
+		"seekid 3 10":  "",
+	})
+	defer mp.Close()
+	assert.NoError(mp.SeekTo(62.5))
+	assert.NoError(mp.SeekOffset(30))
+	assert.NoError(mp.SeekOffset(-2.5))
+	assert.NoError(mp.SeekID(3, 10))
+	assert.Equal([]string{"seekcur 62.5", "seekcur +30", "seekcur -2.5", "seekid 3 10"}, d.cmds)
+}
@@ -2,6 +2,7 @@ package mpd
 
 import (
 	"net"
+	"strings"
 	"time"
 
 	"github.com/rotisserie/eris"
@@ -15,6 +16,10 @@ type dialer interface {
 // DefaultPort is the default TCP port to the MPD service.
 const DefaultPort = 6600
 
+// Time given to MPD to accept a connection, so that an unreachable server is
+// reported early rather than after the system's TCP timeout.
+const dialTimeout = 3 * time.Second
+
 var (
 	netDialer = new(tcpDialer)
 	// Useful for testing.
@@ -28,20 +33,24 @@ func (t *tcpDialer) Name() string {
 	return "MPD dialer"
 }
 
+// Dial connects to MPD over TCP, or to its unix socket if host is an
+// absolute path. Gives up after dialTimeout.
 func (t *tcpDialer) Dial(host string, port int) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	if strings.HasPrefix(host, "/") {
+		conn, err := d.Dial("unix", host)
+		return conn, eris.Wrap(err, "dial")
+	}
 	ips, err := net.LookupIP(host)
 	if err != nil {
 		return nil, eris.Wrapf(err, "can't dial %q", host)
 	}
-	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{
-		IP:   ips[0],
-		Port: port,
-	})
+	conn, err := d.Dial("tcp", (&net.TCPAddr{IP: ips[0], Port: port}).String())
 	if err != nil {
 		return nil, eris.Wrap(err, "dial")
 	}
 	// Keep the TCP connection alive.
-	conn.SetKeepAlive(true)
+	conn.(*net.TCPConn).SetKeepAlive(true)
 	return conn, nil
 }
 
@@ -1,9 +1,35 @@
 package types
 
+// NoFade is the fade-in or fade-out duration of a bookmark whose fade is
+// turned off, written fadein=0 or fadeout=0 in bookmarks files.
+const NoFade = -1
+
 // Bookmark is a time range (point of interest), with a start and end time.
 // Both start and end have MM:SS formatting.
 type Bookmark struct {
 	Start, End string
+	// Rating from 1 to 5, used to weight random playback. Zero if unrated.
+	Rating int
+	// Fade-in and fade-out durations in seconds. Zero to use the default,
+	// NoFade to turn the fade off.
+	FadeIn, FadeOut float64
+	// Tags of the song, to find it again if moved in the music library.
+	Tags SongTags
+}
+
+// SongTags identify a song independently of its location in the music
+// library.
+type SongTags struct {
+	Artist, Album, Title, Track string
+	// Duration in seconds.
+	Duration int
+	// MusicBrainz IDs.
+	MBTrackID, MBAlbumID string
+}
+
+// IsZero returns true if no tag is set.
+func (t SongTags) IsZero() bool {
+	return t == SongTags{}
 }
 
 // BookmarkSet is a map of song name as a key and an associated list of bookmarks.
@@ -19,6 +19,22 @@ type Song struct {
 	Time         int64
 	Title        string
 	Track        string
+	// MusicBrainz IDs, if tagged.
+	MBTrackID string
+	MBAlbumID string
+}
+
+// Tags returns the tags identifying the song.
+func (s *Song) Tags() SongTags {
+	return SongTags{
+		Artist:    s.Artist,
+		Album:     s.Album,
+		Title:     s.Title,
+		Track:     s.Track,
+		Duration:  int(s.Duration),
+		MBTrackID: s.MBTrackID,
+		MBAlbumID: s.MBAlbumID,
+	}
 }
 
 // Status of current song.
@@ -31,3 +47,24 @@ type Status struct {
 	State   string
 	Volume  int64
 }
+
+// Output is an audio output of MPD.
+type Output struct {
+	ID      int
+	Name    string
+	Plugin  string
+	Enabled bool
+	// Runtime attributes, depending on the output plugin.
+	Attributes map[string]string
+}
+
+// Entry is an entry of the music database: a directory, a song or a stored
+// playlist.
+type Entry struct {
+	// Path relative to the music directory.
+	Path string
+	// Set if the entry is a song.
+	Song *Song
+	// True if the entry is a directory.
+	Directory bool
+}